@@ -0,0 +1,212 @@
+package analysis
+
+import (
+	"math"
+)
+
+// An Interval is a confidence interval for a mean.
+type Interval struct {
+	// Mean is the point estimate.
+	Mean float64
+	// HalfWidth is the distance from Mean to either end of the interval.
+	// It's +Inf when there are too few observations to say anything.
+	HalfWidth float64
+	// Confidence is the confidence level, e.g. 0.95.
+	Confidence float64
+	// N is the number of (independent) observations the interval is based
+	// on. For batch means, this is the number of batches.
+	N int
+}
+
+// Lower returns the lower end of the interval.
+func (iv Interval) Lower() float64 {
+	return iv.Mean - iv.HalfWidth
+}
+
+// Upper returns the upper end of the interval.
+func (iv Interval) Upper() float64 {
+	return iv.Mean + iv.HalfWidth
+}
+
+// RelHalfWidth returns the half-width as a fraction of the mean.
+func (iv Interval) RelHalfWidth() float64 {
+	return iv.HalfWidth / math.Abs(iv.Mean)
+}
+
+// Contains returns true if x is inside the interval.
+func (iv Interval) Contains(x float64) bool {
+	return x >= iv.Lower() && x <= iv.Upper()
+}
+
+// MeanCI returns a Student-t confidence interval for the mean of xs. The
+// observations should be independent and identically distributed: for
+// example, one scalar result from each of several replications.
+func MeanCI(xs []float64, confidence float64) Interval {
+	var t Tally
+	var x float64
+	for _, x = range xs {
+		t.Add(x)
+	}
+	return t.CI(confidence)
+}
+
+// BatchMeansCI returns a confidence interval for the steady-state mean of a
+// single long run's observations, using the method of batch means.
+//
+// The observations (which are typically autocorrelated: think of
+// successive customers' wait times) are split into nBatches contiguous
+// batches of equal size, and the batch means are treated as independent.
+// If len(obs) isn't a multiple of nBatches, the leftover observations at
+// the end are ignored. Warm-up observations should be discarded before
+// calling BatchMeansCI.
+//
+// Somewhere between 10 and 30 batches is usually a good choice.
+func BatchMeansCI(obs []float64, nBatches int, confidence float64) Interval {
+	var means []float64
+	var size, b, i int
+	var sum float64
+
+	if nBatches < 1 {
+		panic("BatchMeansCI needs at least one batch")
+	}
+	size = len(obs) / nBatches
+	if size == 0 {
+		return newInterval(0, math.NaN(), math.NaN(), confidence)
+	}
+	means = make([]float64, nBatches)
+	for b = 0; b < nBatches; b++ {
+		sum = 0
+		for i = b * size; i < (b+1)*size; i++ {
+			sum += obs[i]
+		}
+		means[b] = sum / float64(size)
+	}
+	return MeanCI(means, confidence)
+}
+
+// newInterval builds an Interval from the number of observations and their
+// sample mean and variance.
+func newInterval(n int, mean, variance, confidence float64) Interval {
+	var iv Interval
+	iv = Interval{Mean: mean, Confidence: confidence, N: n, HalfWidth: math.Inf(1)}
+	if n >= 2 {
+		iv.HalfWidth = StudentTQuantile(0.5+confidence/2, n-1) * math.Sqrt(variance/float64(n))
+	}
+	return iv
+}
+
+// StudentTQuantile returns the p-quantile of Student's t distribution with
+// df degrees of freedom. For example, StudentTQuantile(0.975, 10) is about
+// 2.228.
+func StudentTQuantile(p float64, df int) float64 {
+	var lo, hi, mid float64
+	var i int
+
+	if p <= 0 || p >= 1 || df < 1 {
+		return math.NaN()
+	}
+	if p < 0.5 {
+		return -StudentTQuantile(1-p, df)
+	}
+	if p == 0.5 {
+		return 0
+	}
+
+	// The CDF is monotonic, so bisect. Start by finding an upper bound.
+	hi = 1
+	for studentTCDF(hi, df) < p {
+		hi *= 2
+	}
+	for i = 0; i < 200 && hi-lo > 1e-12*hi; i++ {
+		mid = (lo + hi) / 2
+		if studentTCDF(mid, df) < p {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// studentTCDF returns P(T <= t) for Student's t distribution with df
+// degrees of freedom.
+func studentTCDF(t float64, df int) float64 {
+	var v, tail float64
+	v = float64(df)
+	tail = 0.5 * regIncBeta(v/2, 0.5, v/(v+t*t))
+	if t >= 0 {
+		return 1 - tail
+	}
+	return tail
+}
+
+// regIncBeta returns the regularized incomplete beta function I_x(a, b).
+func regIncBeta(a, b, x float64) float64 {
+	var lbeta, front float64
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	lgab, _ := math.Lgamma(a + b)
+	lbeta = lgab - lga - lgb
+	front = math.Exp(lbeta + a*math.Log(x) + b*math.Log(1-x))
+	// The continued fraction converges quickly only on this side of the
+	// distribution's mean, so use the symmetry relation on the other side.
+	if x < (a+1)/(a+b+2) {
+		return front * betaContFrac(a, b, x) / a
+	}
+	return 1 - front*betaContFrac(b, a, 1-x)/b
+}
+
+// betaContFrac evaluates the continued fraction for the incomplete beta
+// function by the modified Lentz method.
+func betaContFrac(a, b, x float64) float64 {
+	const tiny = 1e-300
+	const eps = 1e-15
+	var c, d, h, aa, del float64
+	var m, m2 float64
+	var i int
+
+	c = 1
+	d = 1 - (a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h = d
+	for i = 1; i <= 300; i++ {
+		m = float64(i)
+		m2 = 2 * m
+		aa = m * (b - m) * x / ((a + m2 - 1) * (a + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+		aa = -(a + m) * (a + b + m) * x / ((a + m2) * (a + m2 + 1))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del = d * c
+		h *= del
+		if math.Abs(del-1) < eps {
+			break
+		}
+	}
+	return h
+}
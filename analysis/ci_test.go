@@ -0,0 +1,119 @@
+package analysis
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Tests StudentTQuantile against values from a t table.
+func TestStudentTQuantile(t *testing.T) {
+	t.Parallel()
+	type quantileCase struct {
+		P   float64
+		DF  int
+		Exp float64
+	}
+	var c quantileCase
+	cases := []quantileCase{
+		{0.975, 1, 12.706},
+		{0.975, 2, 4.303},
+		{0.975, 10, 2.228},
+		{0.95, 5, 2.015},
+		{0.995, 30, 2.750},
+		{0.975, 1000, 1.962},
+		{0.025, 10, -2.228},
+		{0.5, 7, 0},
+	}
+	for _, c = range cases {
+		got := StudentTQuantile(c.P, c.DF)
+		if math.Abs(got-c.Exp) > 0.001 {
+			t.Log("StudentTQuantile(", c.P, ",", c.DF, ") should be", c.Exp, "but got", got)
+			t.Fail()
+		}
+	}
+}
+
+// Tests a confidence interval computed by hand.
+func TestMeanCI(t *testing.T) {
+	t.Parallel()
+	var iv Interval
+
+	iv = MeanCI([]float64{10, 12, 14}, 0.95)
+	// sd = 2, n = 3, t(0.975, 2) = 4.303
+	if iv.Mean != 12 || math.Abs(iv.HalfWidth-4.303*2/math.Sqrt(3)) > 0.001 || iv.N != 3 {
+		t.Log("Got wrong interval", iv)
+		t.Fail()
+	}
+	if !iv.Contains(12) || iv.Contains(20) {
+		t.Log("Contains gave the wrong answer for", iv)
+		t.Fail()
+	}
+
+	iv = MeanCI([]float64{10}, 0.95)
+	if !math.IsInf(iv.HalfWidth, 1) {
+		t.Log("Interval from a single observation should have infinite half-width; got", iv.HalfWidth)
+		t.Fail()
+	}
+}
+
+// Tests that 95% intervals cover the true mean about 95% of the time.
+func TestMeanCICoverage(t *testing.T) {
+	t.Parallel()
+	var r *rand.Rand
+	var xs []float64
+	var i, j, covered int
+
+	r = rand.New(rand.NewSource(1))
+	xs = make([]float64, 10)
+	for i = 0; i < 2000; i++ {
+		for j = range xs {
+			xs[j] = r.NormFloat64()*3 + 7
+		}
+		if MeanCI(xs, 0.95).Contains(7) {
+			covered++
+		}
+	}
+	if covered < 1850 || covered > 1950 {
+		t.Log("Expected about 1900 of 2000 intervals to cover the mean but got", covered)
+		t.Fail()
+	}
+}
+
+// Tests batch means on an autocorrelated series, where treating every
+// observation as independent would give far too narrow an interval.
+func TestBatchMeansCI(t *testing.T) {
+	t.Parallel()
+	var r *rand.Rand
+	var obs []float64
+	var x float64
+	var i, covered, rep int
+	var iv, naive Interval
+
+	r = rand.New(rand.NewSource(2))
+	obs = make([]float64, 20000)
+	for rep = 0; rep < 100; rep++ {
+		// AR(1) process with mean 0 and strong positive correlation.
+		x = 0
+		for i = range obs {
+			x = 0.9*x + r.NormFloat64()
+			obs[i] = x
+		}
+		iv = BatchMeansCI(obs, 20, 0.95)
+		if iv.N != 20 {
+			t.Fatal("Expected an interval based on 20 batches but got", iv.N)
+		}
+		if iv.Contains(0) {
+			covered++
+		}
+	}
+	if covered < 85 {
+		t.Log("Expected about 95 of 100 batch-means intervals to cover the mean but got", covered)
+		t.Fail()
+	}
+	naive = MeanCI(obs, 0.95)
+	if naive.HalfWidth > iv.HalfWidth/2 {
+		t.Log("Expected batch means to give a much wider interval than the naive one")
+		t.Fail()
+	}
+}
@@ -0,0 +1,248 @@
+package analysis
+
+import (
+	"math"
+)
+
+// DefaultRelativeError is the accuracy of a Sketch that wasn't created with
+// NewSketch.
+const DefaultRelativeError = 0.01
+
+// sketchMaxBins bounds the number of bins a Sketch will keep. With the
+// default relative error, this covers values from 1 up to about 10^17
+// before any bins have to be collapsed.
+const sketchMaxBins = 2048
+
+// Observations smaller than sketchMinValue are counted as zero.
+const sketchMinValue = 1e-9
+
+// A Sketch estimates quantiles of a stream of nonnegative observations (wait
+// times, say) without storing the observations themselves.
+//
+// Observations are counted in logarithmically sized bins, so that every
+// quantile the Sketch reports is within a fixed relative error of the true
+// value: if the relative error is 0.01 and the true median is 1000, the
+// estimate will be between 990 and 1010. Memory use depends on the range of
+// the observations rather than on how many there are, and is never more
+// than a couple of thousand bins. If that limit is reached, the bins
+// holding the smallest values are collapsed together, and the error
+// guarantee no longer holds for the lowest quantiles.
+//
+// Sketches with the same relative error can be merged, so you can sketch
+// each replication separately and then combine them.
+//
+// The zero value is an empty Sketch with DefaultRelativeError, ready to use.
+type Sketch struct {
+	relErr  float64
+	lnGamma float64
+	// Counts for bins offset, offset+1, ..., offset+len(bins)-1. Bin i
+	// holds observations in the range (gamma^(i-1), gamma^i].
+	bins   []int
+	offset int
+	// The number of observations too small to index.
+	zeros    int
+	n        int
+	min, max float64
+}
+
+// NewSketch creates an empty Sketch whose quantile estimates will be within
+// relErr of the true values. relErr must be between 0 and 1.
+func NewSketch(relErr float64) *Sketch {
+	var s *Sketch
+	if relErr <= 0 || relErr >= 1 {
+		panic("Sketch relative error must be between 0 and 1")
+	}
+	s = new(Sketch)
+	s.setRelativeError(relErr)
+	return s
+}
+
+// setRelativeError sets up the bin boundaries for the given accuracy.
+func (s *Sketch) setRelativeError(relErr float64) {
+	s.relErr = relErr
+	s.lnGamma = math.Log((1 + relErr) / (1 - relErr))
+}
+
+// init makes sure a zero-value Sketch has its bin boundaries set up.
+func (s *Sketch) init() {
+	if s.relErr == 0 {
+		s.setRelativeError(DefaultRelativeError)
+	}
+}
+
+// RelativeError returns the accuracy of the Sketch's quantile estimates.
+func (s *Sketch) RelativeError() float64 {
+	s.init()
+	return s.relErr
+}
+
+// Add records an observation. Add panics if x is negative.
+func (s *Sketch) Add(x float64) {
+	s.init()
+	if x < 0 {
+		panic("Sketch can't record negative observations")
+	}
+	if s.n == 0 || x < s.min {
+		s.min = x
+	}
+	if s.n == 0 || x > s.max {
+		s.max = x
+	}
+	s.n++
+	if x < sketchMinValue {
+		s.zeros++
+		return
+	}
+	s.addToBin(s.index(x), 1)
+}
+
+// Merge adds all the observations recorded by other to s. Merge panics if
+// the two Sketches have different relative errors.
+func (s *Sketch) Merge(other *Sketch) {
+	var k, c int
+	if other.n == 0 {
+		return
+	}
+	if s.n == 0 && s.relErr == 0 {
+		s.setRelativeError(other.RelativeError())
+	}
+	if s.RelativeError() != other.RelativeError() {
+		panic("can't merge Sketches with different relative errors")
+	}
+
+	if s.n == 0 || other.min < s.min {
+		s.min = other.min
+	}
+	if s.n == 0 || other.max > s.max {
+		s.max = other.max
+	}
+	s.n += other.n
+	s.zeros += other.zeros
+	if len(other.bins) == 0 {
+		return
+	}
+	// Make room for all of other's bins at once, then add them.
+	s.addToBin(other.offset+len(other.bins)-1, 0)
+	s.addToBin(other.offset, 0)
+	for k, c = range other.bins {
+		s.addToBin(other.offset+k, c)
+	}
+}
+
+// Reset discards all the observations recorded so far. The relative error
+// stays the same.
+func (s *Sketch) Reset() {
+	*s = Sketch{relErr: s.relErr, lnGamma: s.lnGamma}
+}
+
+// Count returns the number of observations.
+func (s *Sketch) Count() int {
+	return s.n
+}
+
+// Min returns the smallest observation, or NaN if there are none.
+func (s *Sketch) Min() float64 {
+	if s.n == 0 {
+		return math.NaN()
+	}
+	return s.min
+}
+
+// Max returns the largest observation, or NaN if there are none.
+func (s *Sketch) Max() float64 {
+	if s.n == 0 {
+		return math.NaN()
+	}
+	return s.max
+}
+
+// Quantile returns an estimate of the q-quantile of the observations, where
+// q is between 0 and 1; for example, Quantile(0.9) estimates the 90th
+// percentile. It returns NaN if there are no observations.
+//
+// The estimate is within RelativeError of the observation that would be at
+// index floor(q*(Count()-1)) if all the observations were sorted.
+func (s *Sketch) Quantile(q float64) float64 {
+	var rank, cum, k, c int
+	if s.n == 0 {
+		return math.NaN()
+	}
+	if q <= 0 {
+		return s.min
+	}
+	if q >= 1 {
+		return s.max
+	}
+
+	rank = int(q * float64(s.n-1))
+	cum = s.zeros
+	if cum > rank {
+		return s.min
+	}
+	for k, c = range s.bins {
+		cum += c
+		if cum > rank {
+			return math.Max(s.min, math.Min(s.max, s.value(s.offset+k)))
+		}
+	}
+	return s.max
+}
+
+// index returns the bin that x belongs in.
+func (s *Sketch) index(x float64) int {
+	return int(math.Ceil(math.Log(x) / s.lnGamma))
+}
+
+// value returns the representative value of bin i: the point that's within
+// the relative error of every value in the bin.
+func (s *Sketch) value(i int) float64 {
+	var gamma float64
+	gamma = math.Exp(s.lnGamma)
+	return 2 * math.Exp(float64(i)*s.lnGamma) / (gamma + 1)
+}
+
+// addToBin adds count observations to bin i, growing the list of bins if
+// necessary. If that would make the list too long, the lowest bins are
+// collapsed into one.
+func (s *Sketch) addToBin(i, count int) {
+	var lo, hi int
+	if len(s.bins) == 0 {
+		s.bins = []int{0}
+		s.offset = i
+	}
+	lo, hi = s.offset, s.offset+len(s.bins)-1
+	if i < lo {
+		lo = i
+	}
+	if i > hi {
+		hi = i
+	}
+	if hi-lo+1 > sketchMaxBins {
+		lo = hi - sketchMaxBins + 1
+	}
+	if i < lo {
+		i = lo
+	}
+	s.resize(lo, hi)
+	s.bins[i-s.offset] += count
+}
+
+// resize makes the list of bins run from lo to hi. Any bins below lo are
+// collapsed into bin lo.
+func (s *Sketch) resize(lo, hi int) {
+	var bins []int
+	var k, c, i int
+	if lo == s.offset && hi == s.offset+len(s.bins)-1 {
+		return
+	}
+	bins = make([]int, hi-lo+1)
+	for k, c = range s.bins {
+		i = s.offset + k
+		if i < lo {
+			i = lo
+		}
+		bins[i-lo] += c
+	}
+	s.bins = bins
+	s.offset = lo
+}
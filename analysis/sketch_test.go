@@ -0,0 +1,120 @@
+package analysis
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// Tests that the Sketch's quantile estimates are within its relative error
+// of the exact quantiles.
+func TestSketchQuantile(t *testing.T) {
+	t.Parallel()
+	var s Sketch
+	var obs []float64
+	var r *rand.Rand
+	var i int
+	var q, exact, est float64
+
+	r = rand.New(rand.NewSource(3))
+	for i = 0; i < 100000; i++ {
+		x := math.Floor(r.ExpFloat64() * 60000)
+		obs = append(obs, x)
+		s.Add(x)
+	}
+	sort.Float64s(obs)
+
+	if s.Count() != len(obs) || s.Min() != obs[0] || s.Max() != obs[len(obs)-1] {
+		t.Log("Sketch has wrong count, min, or max")
+		t.Fail()
+	}
+	for _, q = range []float64{0, 0.01, 0.1, 0.25, 0.5, 0.9, 0.99, 0.999, 1} {
+		exact = obs[int(q*float64(len(obs)-1))]
+		est = s.Quantile(q)
+		if math.Abs(est-exact) > s.RelativeError()*exact+1e-9 {
+			t.Log("Quantile", q, "should be near", exact, "but got", est)
+			t.Fail()
+		}
+	}
+	if len(s.bins) > 2000 {
+		t.Log("Sketch used", len(s.bins), "bins for 100000 observations")
+		t.Fail()
+	}
+}
+
+// Tests that merging two Sketches is the same as adding everything to one.
+func TestSketchMerge(t *testing.T) {
+	t.Parallel()
+	var all, a, b Sketch
+	var c *Sketch
+	var r *rand.Rand
+	var i int
+	var q float64
+
+	r = rand.New(rand.NewSource(4))
+	for i = 0; i < 5000; i++ {
+		x := r.ExpFloat64() * 100
+		if i%7 == 0 {
+			x = 0
+		}
+		all.Add(x)
+		if i%2 == 0 {
+			a.Add(x)
+		} else {
+			b.Add(x)
+		}
+	}
+	// Merging into an empty Sketch mustn't share bins with the original.
+	c = new(Sketch)
+	c.Merge(&a)
+	c.Merge(&b)
+	a.Add(1e6)
+
+	if c.Count() != all.Count() || c.Min() != all.Min() || c.Max() != all.Max() {
+		t.Log("Merged Sketch has wrong count, min, or max")
+		t.Fail()
+	}
+	for _, q = range []float64{0.05, 0.3, 0.5, 0.75, 0.95} {
+		if c.Quantile(q) != all.Quantile(q) {
+			t.Log("Quantile", q, "of merged Sketch is", c.Quantile(q), "but should be", all.Quantile(q))
+			t.Fail()
+		}
+	}
+}
+
+// Tests that Sketches with different accuracies can't be merged.
+func TestSketchMergeMismatch(t *testing.T) {
+	t.Parallel()
+	defer func() {
+		if recover() == nil {
+			t.Log("Expected merging mismatched Sketches to panic")
+			t.Fail()
+		}
+	}()
+	a := NewSketch(0.01)
+	b := NewSketch(0.05)
+	b.Add(10)
+	a.Merge(b)
+}
+
+// Tests that the number of bins stays bounded even for wildly spread-out
+// observations.
+func TestSketchBoundedMemory(t *testing.T) {
+	t.Parallel()
+	var s *Sketch
+	var i int
+
+	s = NewSketch(0.001)
+	for i = -300; i <= 300; i++ {
+		s.Add(math.Pow(10, float64(i)/10))
+	}
+	if len(s.bins) > sketchMaxBins {
+		t.Log("Sketch kept", len(s.bins), "bins; limit is", sketchMaxBins)
+		t.Fail()
+	}
+	if math.Abs(s.Quantile(0.99)-math.Pow(10, 29.4)) > 0.001*math.Pow(10, 29.4) {
+		t.Log("High quantiles should still be accurate after collapsing; got", s.Quantile(0.99))
+		t.Fail()
+	}
+}
@@ -0,0 +1,67 @@
+package analysis
+
+import (
+	"math"
+)
+
+// A StoppingRule decides when a simulation has produced enough data: that
+// is, when the confidence interval for the quantity of interest is narrow
+// enough.
+type StoppingRule struct {
+	// HalfWidth is the target half-width. If Relative is true, it's a
+	// fraction of the mean (e.g. 0.05 means "within 5%"); otherwise it's
+	// in the same units as the observations.
+	HalfWidth float64
+	Relative  bool
+	// Confidence is the confidence level, e.g. 0.95.
+	Confidence float64
+	// MinN is the minimum number of observations (replications or
+	// batches) required before the rule can be satisfied. Values below 2
+	// are treated as 2.
+	MinN int
+	// MaxN is the number of observations after which we give up. If MaxN
+	// is 0, there's no limit.
+	MaxN int
+}
+
+// Satisfied returns true if the interval is narrow enough and is based on
+// enough observations.
+func (r StoppingRule) Satisfied(iv Interval) bool {
+	var hw float64
+	if iv.N < r.MinN || iv.N < 2 {
+		return false
+	}
+	hw = iv.HalfWidth
+	if r.Relative {
+		hw = iv.RelHalfWidth()
+	}
+	return !math.IsNaN(hw) && hw < r.HalfWidth
+}
+
+// Exhausted returns true if the interval is based on MaxN or more
+// observations.
+func (r StoppingRule) Exhausted(iv Interval) bool {
+	return r.MaxN > 0 && iv.N >= r.MaxN
+}
+
+// Replicate calls next(0), next(1), ... to collect independent observations
+// (typically, each call runs a replication of a simulation and returns a
+// scalar result) until the rule is satisfied or MaxN observations have been
+// collected.
+//
+// It returns the final confidence interval and whether the rule was
+// satisfied.
+func (r StoppingRule) Replicate(next func(i int) float64) (iv Interval, ok bool) {
+	var t Tally
+	var i int
+	for i = 0; ; i++ {
+		t.Add(next(i))
+		iv = t.CI(r.Confidence)
+		if r.Satisfied(iv) {
+			return iv, true
+		}
+		if r.Exhausted(iv) {
+			return iv, false
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package analysis
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// Tests that Replicate keeps going until the interval is narrow enough.
+func TestStoppingRuleReplicate(t *testing.T) {
+	t.Parallel()
+	var r *rand.Rand
+	var rule StoppingRule
+	var iv Interval
+	var ok bool
+	var calls int
+
+	r = rand.New(rand.NewSource(3))
+	next := func(i int) float64 {
+		if i != calls {
+			t.Fatal("Replicate called next with", i, "but expected", calls)
+		}
+		calls++
+		return r.NormFloat64()*10 + 100
+	}
+
+	rule = StoppingRule{HalfWidth: 1, Confidence: 0.95, MinN: 5}
+	iv, ok = rule.Replicate(next)
+	if !ok || iv.HalfWidth >= 1 {
+		t.Log("Expected Replicate to reach half-width 1 but got", iv.HalfWidth)
+		t.Fail()
+	}
+	// With sd 10, we need roughly (1.96*10/1)^2 = 384 observations.
+	if calls < 300 || calls > 500 || iv.N != calls {
+		t.Log("Expected roughly 384 observations but Replicate made", calls)
+		t.Fail()
+	}
+
+	calls = 0
+	rule = StoppingRule{HalfWidth: 0.01, Relative: true, Confidence: 0.95, MaxN: 50}
+	iv, ok = rule.Replicate(next)
+	if ok || calls != 50 {
+		t.Log("Expected Replicate to give up after 50 observations; made", calls)
+		t.Fail()
+	}
+}
+
+// Tests the MinN requirement of Satisfied.
+func TestStoppingRuleSatisfied(t *testing.T) {
+	t.Parallel()
+	var rule StoppingRule
+
+	rule = StoppingRule{HalfWidth: 1, Confidence: 0.95, MinN: 10}
+	if rule.Satisfied(Interval{Mean: 5, HalfWidth: 0.5, N: 9}) {
+		t.Log("Rule shouldn't be satisfied with fewer than MinN observations")
+		t.Fail()
+	}
+	if !rule.Satisfied(Interval{Mean: 5, HalfWidth: 0.5, N: 10}) {
+		t.Log("Rule should be satisfied")
+		t.Fail()
+	}
+	rule.Relative = true
+	rule.HalfWidth = 0.05
+	if rule.Satisfied(Interval{Mean: 5, HalfWidth: 0.5, N: 10}) {
+		t.Log("Relative rule shouldn't be satisfied by a 10% half-width")
+		t.Fail()
+	}
+}
@@ -0,0 +1,117 @@
+// Package analysis provides tools for analyzing the output of qsim
+// simulations: accumulating observations, computing confidence intervals
+// (from independent replications or by batch means), and deciding when a
+// simulation has been run long enough.
+package analysis
+
+import (
+	"math"
+)
+
+// A Tally accumulates observations and keeps track of their count, mean,
+// variance, minimum, and maximum without storing the observations
+// themselves.
+//
+// The zero value is an empty Tally, ready to use.
+type Tally struct {
+	n        int
+	mean     float64
+	m2       float64
+	min, max float64
+}
+
+// Add records an observation.
+func (t *Tally) Add(x float64) {
+	var delta float64
+	t.n++
+	if t.n == 1 {
+		t.min, t.max = x, x
+	} else {
+		t.min = math.Min(t.min, x)
+		t.max = math.Max(t.max, x)
+	}
+	// Welford's algorithm, which is much less prone to rounding error
+	// than summing squares.
+	delta = x - t.mean
+	t.mean += delta / float64(t.n)
+	t.m2 += delta * (x - t.mean)
+}
+
+// Merge adds all the observations recorded by other to t.
+func (t *Tally) Merge(other *Tally) {
+	var n float64
+	var delta float64
+	if other.n == 0 {
+		return
+	}
+	if t.n == 0 {
+		*t = *other
+		return
+	}
+	n = float64(t.n + other.n)
+	delta = other.mean - t.mean
+	t.m2 += other.m2 + delta*delta*float64(t.n)*float64(other.n)/n
+	t.mean += delta * float64(other.n) / n
+	t.n += other.n
+	t.min = math.Min(t.min, other.min)
+	t.max = math.Max(t.max, other.max)
+}
+
+// Reset discards all the observations recorded so far.
+func (t *Tally) Reset() {
+	*t = Tally{}
+}
+
+// Count returns the number of observations.
+func (t *Tally) Count() int {
+	return t.n
+}
+
+// Mean returns the mean of the observations, or NaN if there are none.
+func (t *Tally) Mean() float64 {
+	if t.n == 0 {
+		return math.NaN()
+	}
+	return t.mean
+}
+
+// Sum returns the sum of the observations.
+func (t *Tally) Sum() float64 {
+	return t.mean * float64(t.n)
+}
+
+// Variance returns the sample variance of the observations, or NaN if there
+// are fewer than 2.
+func (t *Tally) Variance() float64 {
+	if t.n < 2 {
+		return math.NaN()
+	}
+	return t.m2 / float64(t.n-1)
+}
+
+// StdDev returns the sample standard deviation of the observations.
+func (t *Tally) StdDev() float64 {
+	return math.Sqrt(t.Variance())
+}
+
+// Min returns the smallest observation, or NaN if there are none.
+func (t *Tally) Min() float64 {
+	if t.n == 0 {
+		return math.NaN()
+	}
+	return t.min
+}
+
+// Max returns the largest observation, or NaN if there are none.
+func (t *Tally) Max() float64 {
+	if t.n == 0 {
+		return math.NaN()
+	}
+	return t.max
+}
+
+// CI returns a Student-t confidence interval for the mean of the
+// observations, treating them as independent and identically distributed.
+func (t *Tally) CI(confidence float64) Interval {
+	return newInterval(t.n, t.Mean(), t.Variance(), confidence)
+}
@@ -0,0 +1,64 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+)
+
+// Tests the basic summary statistics kept by Tally.
+func TestTally(t *testing.T) {
+	t.Parallel()
+	var tl Tally
+	var x float64
+
+	if !math.IsNaN(tl.Mean()) || tl.Count() != 0 {
+		t.Log("Empty Tally should have count 0 and NaN mean")
+		t.Fail()
+	}
+	for _, x = range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		tl.Add(x)
+	}
+	if tl.Count() != 8 || tl.Mean() != 5 || tl.Sum() != 40 {
+		t.Log("Expected count 8, mean 5, sum 40 but got", tl.Count(), tl.Mean(), tl.Sum())
+		t.Fail()
+	}
+	if math.Abs(tl.Variance()-32.0/7.0) > 1e-12 {
+		t.Log("Expected variance", 32.0/7.0, "but got", tl.Variance())
+		t.Fail()
+	}
+	if tl.Min() != 2 || tl.Max() != 9 {
+		t.Log("Expected min 2 and max 9 but got", tl.Min(), tl.Max())
+		t.Fail()
+	}
+	tl.Reset()
+	if tl.Count() != 0 {
+		t.Log("Reset didn't empty the Tally")
+		t.Fail()
+	}
+}
+
+// Tests that merging two Tallies is the same as adding everything to one.
+func TestTallyMerge(t *testing.T) {
+	t.Parallel()
+	var a, b, all Tally
+	var i int
+
+	for i = 0; i < 100; i++ {
+		x := float64(i*i%37) - 3.5
+		all.Add(x)
+		if i < 30 {
+			a.Add(x)
+		} else {
+			b.Add(x)
+		}
+	}
+	a.Merge(&b)
+	if a.Count() != all.Count() || math.Abs(a.Mean()-all.Mean()) > 1e-9 || math.Abs(a.Variance()-all.Variance()) > 1e-9 {
+		t.Log("Merged Tally", a.Count(), a.Mean(), a.Variance(), "doesn't match", all.Count(), all.Mean(), all.Variance())
+		t.Fail()
+	}
+	if a.Min() != all.Min() || a.Max() != all.Max() {
+		t.Log("Merged Tally has wrong min or max")
+		t.Fail()
+	}
+}
@@ -24,12 +24,36 @@ type ArrBeh interface {
 // This behavior is like that of a supermarket checkout line: if there's
 // an empty aisle you go straight there; otherwise you find the shortest
 // queue and join it.
+//
+// Whenever a Job is queued, any idle Processors are asked to Pull from
+// their Disciplines, in case one of them would rather take the new Job
+// than stay idle.
+//
+// If Balk is set, a Job that would have to queue may balk instead: it
+// takes one look at the lines and leaves without joining any of them.
 type ShortestQueueArrBeh struct {
 	// Queues contains all the queues known to us.
 	Queues []*Queue
+	// Balk, if it isn't nil, returns the probability that j refuses to
+	// join a Queue, given the lengths of all the Queues, shortest first.
+	// It's only consulted when there's no idle Processor for j.
+	Balk func(j *Job, lengths []int) float64
+	// Lost counts the Jobs that never made it into a Queue or onto a
+	// Processor, by reason: LostFull, LostBalked, or LostNoRoom.
+	Lost map[string]int
 	// IdleProcessors keeps track of which Processors are idle. A Processor
-	// is a key in this map iff it is idle.
+	// is a key in this map iff it is idle; that is, iff it has a free slot.
+	// Processors that are down or closed are never idle, so they never
+	// receive arrivals.
 	IdleProcessors map[*Processor]bool
+	// Rand is used to break ties between Processors and Queues. When the
+	// ShortestQueueArrBeh is part of a Simulation, Rand defaults to the
+	// Simulation's Rand.
+	Rand *rand.Rand
+
+	// All the Processors known to us, in a fixed order so that picking one
+	// at random is reproducible.
+	procs []*Processor
 
 	// Callback lists
 	cbBeforeAssign []func(ab ArrBeh, j *Job) *Assignment
@@ -40,7 +64,6 @@ type ShortestQueueArrBeh struct {
 // The documentation for ShortestQueueArrBeh describes the logic used in
 // this implementation.
 func (ab *ShortestQueueArrBeh) Assign(j *Job) Assignment {
-	var proc *Processor
 	var procs []*Processor
 	var q *Queue
 	var shortQueues []*Queue
@@ -57,13 +80,8 @@ func (ab *ShortestQueueArrBeh) Assign(j *Job) Assignment {
 	}
 
 	// Assign to an idle processor if there is at least one
-	if len(ab.IdleProcessors) >= 1 {
-		procs = make([]*Processor, 0)
-		for proc, _ = range ab.IdleProcessors {
-			procs = append(procs, proc)
-		}
-
-		i = rand.Intn(len(procs))
+	if procs = ab.idleProcs(); len(procs) >= 1 {
+		i = randIntn(ab.Rand, len(procs))
 		ass = Assignment{Type: "Processor", Processor: procs[i]}
 		ab.assign(j, ass)
 		ab.afterAssign(j, ass)
@@ -79,24 +97,74 @@ func (ab *ShortestQueueArrBeh) Assign(j *Job) Assignment {
 	}
 
 	// Pick a random element from the list of queues that have the shortest length.
-	i = rand.Intn(len(shortQueues))
+	i = randIntn(ab.Rand, len(shortQueues))
 	q = shortQueues[i]
 	ab.beforeAssign(j)
 	ass = Assignment{Type: "Queue", Queue: q}
+	if ab.Balk != nil && balks(j, ab.Queues, ab.Balk, ab.Rand) {
+		ass.Type = "Balked"
+	}
 	ab.assign(j, ass)
 	ab.afterAssign(j, ass)
 	return ass
 }
 
+// idleProcs returns the idle Processors in a fixed order, so that picking
+// one at random is reproducible. If the ShortestQueueArrBeh wasn't built by
+// its constructor, it doesn't know the order the Processors were given in,
+// so they're sorted by ProcessorId instead; that's only reproducible if the
+// Processors have distinct ProcessorIds.
+func (ab *ShortestQueueArrBeh) idleProcs() []*Processor {
+	var procs []*Processor
+	var p *Processor
+	var idle bool
+	procs = make([]*Processor, 0, len(ab.IdleProcessors))
+	if len(ab.procs) == 0 {
+		for p, idle = range ab.IdleProcessors {
+			if idle {
+				procs = append(procs, p)
+			}
+		}
+		sort.Slice(procs, func(i, k int) bool { return procs[i].ProcessorId < procs[k].ProcessorId })
+		return procs
+	}
+	for _, p = range ab.procs {
+		if ab.IdleProcessors[p] {
+			procs = append(procs, p)
+		}
+	}
+	return procs
+}
+
 // assign does the appropriate thing with the Job given an Assignment.
 func (ab *ShortestQueueArrBeh) assign(j *Job, ass Assignment) {
 	switch ass.Type {
 	case "Processor":
 		ass.Processor.Start(j)
 		D("Job", j.JobId, "arrived and was assigned to Processor", ass.Processor)
+	case "Preempt":
+		if _, _, err := ass.Processor.Preempt(j, ass.Queue); err != nil {
+			// The Processor can't take the Job, so it waits in the Queue
+			// like any other, if there is one.
+			D("Job", j.JobId, "arrived but couldn't preempt Processor", ass.Processor, ":", err)
+			if ass.Queue == nil {
+				lose(&ab.Lost, LostNoRoom)
+				return
+			}
+			ab.assign(j, Assignment{Type: "Queue", Queue: ass.Queue})
+			return
+		}
+		D("Job", j.JobId, "arrived and preempted Processor", ass.Processor)
 	case "Queue":
+		if ass.Queue.IsFull() {
+			lose(&ab.Lost, LostFull)
+		}
 		ass.Queue.Append(j)
 		D("Job", j.JobId, "arrived and was assigned to Queue", ass.Queue)
+		pullIdle(ab.procs)
+	case "Balked":
+		lose(&ab.Lost, LostBalked)
+		D("Job", j.JobId, "arrived and balked at Queue", ass.Queue)
 	default:
 		panic("Tried to process Assignment with unknown Type '" + ass.Type + "'")
 	}
@@ -139,14 +207,25 @@ func (ab *ShortestQueueArrBeh) afterAssign(j *Job, ass Assignment) {
 	}
 }
 
+func (ab *ShortestQueueArrBeh) bindSimulation(sim *Simulation) {
+	if ab.Rand == nil {
+		ab.Rand = sim.Rand
+	}
+}
+
 // NewShortestQueueArrBeh initializes a ShortestQueueArrBeh with the given Queues &
 // Processors.
+//
+// Jobs that arrive from ap are assigned automatically. ap may be nil for a
+// ShortestQueueArrBeh that only takes Jobs forwarded by a Router.
 func NewShortestQueueArrBeh(queues []*Queue, procs []*Processor, ap ArrProc) ArrBeh {
 	var ab *ShortestQueueArrBeh
 	var p *Processor
 
 	ab = new(ShortestQueueArrBeh)
 	ab.Queues = queues
+	ab.Lost = make(map[string]int)
+	ab.procs = procs
 	ab.IdleProcessors = make(map[*Processor]bool)
 	for _, p = range procs {
 		if p.IsIdle() {
@@ -156,30 +235,84 @@ func NewShortestQueueArrBeh(queues []*Queue, procs []*Processor, ap ArrProc) Arr
 
 	// These callbacks keep ab.IdleProcessors up to date.
 	afterStart := func(p *Processor, j *Job, procTime int) {
-		delete(ab.IdleProcessors, p)
+		if !p.IsIdle() {
+			delete(ab.IdleProcessors, p)
+		}
 	}
 	afterFinish := func(p *Processor, j *Job) {
-		ab.IdleProcessors[p] = true
+		if p.IsIdle() {
+			ab.IdleProcessors[p] = true
+		}
+	}
+	afterFail := func(p *Processor, lost []*Job) {
+		delete(ab.IdleProcessors, p)
+	}
+	afterRepair := func(p *Processor) {
+		if p.IsIdle() {
+			ab.IdleProcessors[p] = true
+		}
+	}
+	afterClose := func(p *Processor, evicted []*Job) {
+		delete(ab.IdleProcessors, p)
+	}
+	afterResize := func(p *Processor, evicted []*Job) {
+		if p.IsIdle() {
+			ab.IdleProcessors[p] = true
+		} else {
+			delete(ab.IdleProcessors, p)
+		}
 	}
 	for _, p = range procs {
 		p.AfterStart(afterStart)
 		p.AfterFinish(afterFinish)
+		p.AfterFail(afterFail)
+		p.AfterRepair(afterRepair)
+		p.AfterClose(afterClose)
+		p.AfterOpen(afterRepair)
+		p.AfterResize(afterResize)
 	}
 
 	// Make sure that newly arriving Jobs get assigned.
-	ap.AfterArrive(func(cbArrProc ArrProc, cbJobs []*Job, cbInterval int) {
-		for _, j := range cbJobs {
-			ab.Assign(j)
-		}
-	})
+	if ap != nil {
+		ap.AfterArrive(func(cbArrProc ArrProc, cbJobs []*Job, cbInterval int) {
+			for _, j := range cbJobs {
+				ab.Assign(j)
+			}
+		})
+	}
 
 	return ab
 }
 
+// NewSharedQueueArrBeh initializes an arrival behavior for a system where
+// many Processors share a single Queue: newly arriving Jobs are started on
+// an idle Processor if there is one, and otherwise appended to q. This is
+// just a ShortestQueueArrBeh with only one Queue to choose from.
+//
+// Use it together with a SharedQueueDiscipline.
+func NewSharedQueueArrBeh(q *Queue, procs []*Processor, ap ArrProc) ArrBeh {
+	return NewShortestQueueArrBeh([]*Queue{q}, procs, ap)
+}
+
 // AlwaysQueueArrBeh always puts incoming jobs in the given queue. Processors
-// don't even enter into it.
+// don't even enter into it, except that any idle Processors listed in
+// Processors are asked to Pull from their Disciplines once the Job has been
+// queued.
 type AlwaysQueueArrBeh struct {
 	Q *Queue
+	// Processors that should be woken up when a Job is queued. This may be
+	// left empty if the Processors are never idle, or if something else
+	// takes care of starting them.
+	Processors []*Processor
+	// Balk, if it isn't nil, returns the probability that j refuses to
+	// join Q, given Q's length (as the only element of lengths).
+	Balk func(j *Job, lengths []int) float64
+	// Lost counts the Jobs that never made it into Q, by reason: LostFull
+	// or LostBalked.
+	Lost map[string]int
+	// Rand is used to decide whether Jobs balk. When the AlwaysQueueArrBeh
+	// is part of a Simulation, Rand defaults to the Simulation's Rand.
+	Rand *rand.Rand
 
 	// Callback lists
 	cbBeforeAssign []func(ab ArrBeh, j *Job) *Assignment
@@ -197,6 +330,9 @@ func (ab *AlwaysQueueArrBeh) Assign(j *Job) Assignment {
 	}
 
 	ass := Assignment{Type: "Queue", Queue: ab.Q}
+	if ab.Balk != nil && balks(j, []*Queue{ab.Q}, ab.Balk, ab.Rand) {
+		ass.Type = "Balked"
+	}
 	ab.assign(j, ass)
 	ab.afterAssign(j, ass)
 	return ass
@@ -205,11 +341,18 @@ func (ab *AlwaysQueueArrBeh) Assign(j *Job) Assignment {
 // assign does the appropriate thing with the Job given an Assignment.
 func (ab *AlwaysQueueArrBeh) assign(j *Job, ass Assignment) {
 	switch ass.Type {
-	case "Processor":
+	case "Processor", "Preempt":
 		panic("AlwaysQueueArrBeh does not support assignment to Processors")
 	case "Queue":
+		if ass.Queue.IsFull() {
+			lose(&ab.Lost, LostFull)
+		}
 		ass.Queue.Append(j)
 		D("Job", j.JobId, "arrived and was assigned to Queue", ass.Queue)
+		pullIdle(ab.Processors)
+	case "Balked":
+		lose(&ab.Lost, LostBalked)
+		D("Job", j.JobId, "arrived and balked at Queue", ass.Queue)
 	default:
 		panic("Tried to process Assignment with unknown Type '" + ass.Type + "'")
 	}
@@ -252,28 +395,86 @@ func (ab *AlwaysQueueArrBeh) afterAssign(j *Job, ass Assignment) {
 	}
 }
 
+func (ab *AlwaysQueueArrBeh) bindSimulation(sim *Simulation) {
+	if ab.Rand == nil {
+		ab.Rand = sim.Rand
+	}
+}
+
 // NewAlwaysQueueArrBeh initializes a AlwaysQueueArrBeh with the given Queue.
+// Jobs that arrive from ap are assigned automatically; ap may be nil.
 func NewAlwaysQueueArrBeh(q *Queue, ap ArrProc) ArrBeh {
 	var ab *AlwaysQueueArrBeh
 
 	ab = new(AlwaysQueueArrBeh)
 	ab.Q = q
+	ab.Lost = make(map[string]int)
 
 	// Make sure that newly arriving Jobs get assigned.
-	ap.AfterArrive(func(cbArrProc ArrProc, cbJobs []*Job, cbInterval int) {
-		for _, j := range cbJobs {
-			ab.Assign(j)
-		}
-	})
+	if ap != nil {
+		ap.AfterArrive(func(cbArrProc ArrProc, cbJobs []*Job, cbInterval int) {
+			for _, j := range cbJobs {
+				ab.Assign(j)
+			}
+		})
+	}
 
 	return ab
 }
 
+// Reasons that an arriving Job might be lost, as counted in the Lost field
+// of an arrival behavior.
+const (
+	// LostFull means the Job was assigned to a Queue that was already at
+	// its MaxLength, so it was discarded.
+	LostFull = "Full"
+	// LostBalked means the Job balked: it decided not to join the Queue.
+	LostBalked = "Balked"
+	// LostNoRoom means the Job was assigned to preempt a Processor that
+	// couldn't take it, and there was no Queue to put it in instead.
+	LostNoRoom = "NoRoom"
+)
+
+// lose counts a Job lost for the given reason in *lost, making the map first
+// if the arrival behavior wasn't built by its constructor.
+func lose(lost *map[string]int, reason string) {
+	if *lost == nil {
+		*lost = make(map[string]int)
+	}
+	(*lost)[reason]++
+}
+
+// balks decides at random whether j balks at the given Queues, according
+// to the probability returned by balk.
+func balks(j *Job, queues []*Queue, balk func(j *Job, lengths []int) float64, r *rand.Rand) bool {
+	var lengths []int
+	var q *Queue
+	lengths = make([]int, 0, len(queues))
+	for _, q = range queues {
+		lengths = append(lengths, q.Length())
+	}
+	return randFloat64(r) < balk(j, lengths)
+}
+
 // An Assignment indicates where a Job has been assigned by an Arrival Behavior.
 //
 // The string Type will be either "Processor" or "Queue", and the corresponding
 // attribute (either Processor or Queue) will contain the entity to which the
 // Job was assigned. The other attribute will be nil.
+//
+// If the Job balked, Type is "Balked" and Queue is the Queue the Job would
+// have joined. A balked Job isn't put anywhere; it just leaves.
+//
+// A Fork or a Join returns an Assignment whose Type is "Fork" or "Join"
+// respectively, and whose Processor and Queue are both nil.
+//
+// A BeforeAssign callback may also return an Assignment whose Type is
+// "Preempt", to start the Job on Processor right away even if that means
+// evicting a Job already in service (see Processor.Preempt). The evicted Job
+// goes back to the head of Queue, if Queue isn't nil. If the Processor can't
+// be preempted, the arriving Job is appended to Queue instead, or counted as
+// lost if Queue is nil. ShortestQueueArrBeh supports this; AlwaysQueueArrBeh
+// doesn't.
 type Assignment struct {
 	Type      string
 	Processor *Processor
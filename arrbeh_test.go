@@ -1,6 +1,7 @@
 package qsim
 
 import (
+	"math/rand"
 	"testing"
 )
 
@@ -107,6 +108,13 @@ func TestShortestQueueArrBeh(t *testing.T) {
 		j, _ = queues[i%3].Shift()
 		procs[i%3].Start(j)
 	}
+	// A Processor whose Queue ran dry is idle now; keep it busy so that
+	// procs[1] is the only idle one.
+	for _, p = range procs {
+		if p.IsIdle() {
+			p.Start(NewJob(0))
+		}
+	}
 	procs[1].Finish()
 	ab.Assign(NewJob(0))
 	if procs[1].IsIdle() {
@@ -272,3 +280,180 @@ func TestShortestQueueArrBehAfterAssign(t *testing.T) {
 		t.Log("Assignment Type was 'Queue' but Queue = nil")
 	}
 }
+
+// Tests that Jobs balk according to the ShortestQueueArrBeh's Balk policy,
+// and only when they'd have to queue.
+func TestShortestQueueArrBehBalk(t *testing.T) {
+	t.Parallel()
+	var queues []*Queue
+	var procs []*Processor
+	var sqab *ShortestQueueArrBeh
+	var ass Assignment
+	var i, balked int
+
+	queues = []*Queue{NewQueue(), NewQueue()}
+	procs = []*Processor{NewProcessor(simplePtg)}
+	sqab = NewShortestQueueArrBeh(queues, procs, NewConstantArrProc(5)).(*ShortestQueueArrBeh)
+	sqab.Rand = rand.New(rand.NewSource(1))
+	sqab.Balk = func(j *Job, lengths []int) float64 {
+		if len(lengths) != 2 || lengths[0] > lengths[1] {
+			t.Log("Balk should get the Queue lengths shortest first, but got", lengths)
+			t.Fail()
+		}
+		if lengths[0] >= 2 {
+			return 1
+		}
+		return 0
+	}
+
+	if ass = sqab.Assign(NewJob(0)); ass.Type != "Processor" {
+		t.Log("Expected first Job to go to the idle Processor but it went to", ass.Type)
+		t.Fail()
+	}
+	for i = 0; i < 10; i++ {
+		ass = sqab.Assign(NewJob(0))
+		if ass.Type == "Balked" {
+			balked++
+			if ass.Queue == nil {
+				t.Log("Balked Assignment should name the Queue the Job refused to join")
+				t.Fail()
+			}
+		}
+	}
+	if balked != 6 || sqab.Lost[LostBalked] != 6 || queues[0].Length()+queues[1].Length() != 4 {
+		t.Log("Expected 4 Jobs to queue and 6 to balk, but", balked, "balked")
+		t.Fail()
+	}
+}
+
+// Tests that AlwaysQueueArrBeh tells Jobs lost to a full Queue apart from
+// Jobs that balked.
+func TestAlwaysQueueArrBehLost(t *testing.T) {
+	t.Parallel()
+	var q *Queue
+	var aqab *AlwaysQueueArrBeh
+	var i int
+
+	q = NewQueue()
+	q.MaxLength = 2
+	aqab = NewAlwaysQueueArrBeh(q, NewConstantArrProc(5)).(*AlwaysQueueArrBeh)
+	aqab.Rand = rand.New(rand.NewSource(1))
+	aqab.Balk = func(j *Job, lengths []int) float64 {
+		if len(lengths) != 1 || lengths[0] != q.Length() {
+			t.Log("Balk should get the length of the Queue but got", lengths)
+			t.Fail()
+		}
+		return 0.5
+	}
+	for i = 0; i < 1000; i++ {
+		aqab.Assign(NewJob(0))
+	}
+
+	if q.Length() != 2 || aqab.Lost[LostFull]+aqab.Lost[LostBalked] != 998 {
+		t.Log("Expected 998 lost Jobs but got", aqab.Lost)
+		t.Fail()
+	}
+	if aqab.Lost[LostBalked] < 450 || aqab.Lost[LostBalked] > 550 {
+		t.Log("Expected about half the Jobs to balk but", aqab.Lost[LostBalked], "did")
+		t.Fail()
+	}
+}
+
+// Tests that arrival behaviors built as struct literals, without their
+// constructors, can still count lost Jobs.
+func TestArrBehLostWithoutConstructor(t *testing.T) {
+	t.Parallel()
+	var q *Queue
+	var aqab *AlwaysQueueArrBeh
+	var sqab *ShortestQueueArrBeh
+
+	q = NewQueue()
+	q.MaxLength = 1
+	aqab = &AlwaysQueueArrBeh{Q: q}
+	aqab.Assign(NewJob(0))
+	aqab.Assign(NewJob(0))
+	if aqab.Lost[LostFull] != 1 {
+		t.Log("Expected 1 Job lost to a full Queue but got", aqab.Lost)
+		t.Fail()
+	}
+
+	sqab = &ShortestQueueArrBeh{Queues: []*Queue{NewQueue()}}
+	sqab.Balk = func(j *Job, lengths []int) float64 { return 1 }
+	sqab.Assign(NewJob(0))
+	if sqab.Lost[LostBalked] != 1 {
+		t.Log("Expected 1 Job to balk but got", sqab.Lost)
+		t.Fail()
+	}
+}
+
+// Tests that a ShortestQueueArrBeh built as a struct literal picks among the
+// Processors in IdleProcessors, the same way every time.
+func TestShortestQueueArrBehIdleWithoutConstructor(t *testing.T) {
+	t.Parallel()
+	var procs []*Processor
+	var picked []*Processor
+	var run, i int
+
+	for i = 0; i < 3; i++ {
+		procs = append(procs, NewProcessor(simplePtg))
+		procs[i].ProcessorId = i
+	}
+	for run = 0; run < 2; run++ {
+		var sqab *ShortestQueueArrBeh
+		var ass Assignment
+		sqab = &ShortestQueueArrBeh{
+			Queues:         []*Queue{NewQueue()},
+			IdleProcessors: map[*Processor]bool{procs[0]: true, procs[1]: true, procs[2]: true},
+			Rand:           rand.New(rand.NewSource(1)),
+		}
+		for i = 0; i < 10; i++ {
+			ass = sqab.Assign(NewJob(0))
+			if ass.Type != "Processor" || ass.Processor == nil {
+				t.Fatal("Expected the Job to go to an idle Processor but it went to", ass.Type)
+			}
+			if run == 0 {
+				picked = append(picked, ass.Processor)
+			} else if picked[i] != ass.Processor {
+				t.Log("Expected the same Processors to be picked with the same seed")
+				t.Fail()
+			}
+		}
+	}
+}
+
+// Tests that a Job assigned to preempt a Processor that can't take it waits
+// in the Queue instead, or is counted as lost if there's no Queue.
+func TestShortestQueueArrBehPreemptRefused(t *testing.T) {
+	t.Parallel()
+	var q *Queue
+	var p *Processor
+	var sqab *ShortestQueueArrBeh
+	var j *Job
+	var target *Queue
+
+	q = NewQueue()
+	p = NewProcessor(simplePtg)
+	p.Capacity = 2
+	p.Start(NewJob(0))
+	p.Start(NewJob(0))
+	p.Capacity = 1
+	sqab = NewShortestQueueArrBeh([]*Queue{q}, []*Processor{p}, nil).(*ShortestQueueArrBeh)
+	sqab.BeforeAssign(func(ab ArrBeh, j *Job) *Assignment {
+		return &Assignment{Type: "Preempt", Processor: p, Queue: target}
+	})
+
+	target = q
+	j = NewJob(0)
+	sqab.Assign(j)
+	if q.Length() != 1 || q.Jobs[0] != j || p.InService() != 2 {
+		t.Log("Expected the Job to be queued when the Processor couldn't be preempted")
+		t.Fail()
+	}
+
+	target = nil
+	sqab.Assign(NewJob(0))
+	if q.Length() != 1 || sqab.Lost[LostNoRoom] != 1 {
+		t.Log("Expected the Job to be lost with no Queue to go to but got", sqab.Lost)
+		t.Fail()
+	}
+}
@@ -5,6 +5,10 @@ import (
 )
 
 // An ArrProc (short for "arrival process") generates new Jobs at some interval.
+//
+// Arrive returns the Jobs that arrived and the number of ticks until it
+// should be called again. A negative interval means there are no more
+// arrivals to come.
 type ArrProc interface {
 	Arrive(clock int) (jobs []*Job, interval int)
 	BeforeArrive(f func(ap ArrProc))
@@ -17,6 +21,13 @@ type ArrProc interface {
 type ConstantArrProc struct {
 	// Interval is the interval at which ConstantArrProc will generate Jobs.
 	Interval int
+	// Rand is the source of JobIds for generated Jobs. When the
+	// ConstantArrProc is part of a Simulation, Rand defaults to the
+	// Simulation's Rand.
+	Rand *rand.Rand
+
+	// The Simulation we're part of, if any.
+	sim *Simulation
 
 	// Callback lists
 	cbBeforeArrive []func(ap ArrProc)
@@ -29,7 +40,7 @@ type ConstantArrProc struct {
 // clock is the current simulation clock time.
 func (ap *ConstantArrProc) Arrive(clock int) (jobs []*Job, interval int) {
 	ap.beforeArrive()
-	jobs = append(jobs, NewJob(clock))
+	jobs = append(jobs, newJob(clock, ap.Rand, ap.sim))
 	interval = ap.Interval
 	ap.afterArrive(jobs, interval)
 	return
@@ -58,6 +69,13 @@ func (ab *ConstantArrProc) afterArrive(jobs []*Job, interval int) {
 	}
 }
 
+func (ap *ConstantArrProc) bindSimulation(sim *Simulation) {
+	ap.sim = sim
+	if ap.Rand == nil {
+		ap.Rand = sim.Rand
+	}
+}
+
 // NewConstantArrProc returns a new ConstantArrProc with the given Interval
 // value.
 func NewConstantArrProc(interval int) (ap *ConstantArrProc) {
@@ -84,6 +102,13 @@ func NewConstantArrProc(interval int) (ap *ConstantArrProc) {
 // PoissonArrProc implements the ArrProc interface.
 type PoissonArrProc struct {
 	Mean float64
+	// Rand is the source of arrival intervals and JobIds. When the
+	// PoissonArrProc is part of a Simulation, Rand defaults to the
+	// Simulation's Rand.
+	Rand *rand.Rand
+
+	// The Simulation we're part of, if any.
+	sim *Simulation
 
 	// Callback lists
 	cbBeforeArrive []func(ap ArrProc)
@@ -96,7 +121,7 @@ type PoissonArrProc struct {
 // clock is the current simulation clock time.
 func (ap *PoissonArrProc) Arrive(clock int) (jobs []*Job, interval int) {
 	ap.beforeArrive()
-	jobs = append(jobs, NewJob(clock))
+	jobs = append(jobs, newJob(clock, ap.Rand, ap.sim))
 	interval = ap.pickInterval()
 	ap.afterArrive(jobs, interval)
 	return
@@ -128,10 +153,17 @@ func (ap *PoissonArrProc) afterArrive(jobs []*Job, interval int) {
 // Picks an arrival interval from an exponential distribution.
 func (ab *PoissonArrProc) pickInterval() int {
 	var r float64
-	r = rand.ExpFloat64() * ab.Mean
+	r = randExpFloat64(ab.Rand) * ab.Mean
 	return int(r)
 }
 
+func (ap *PoissonArrProc) bindSimulation(sim *Simulation) {
+	ap.sim = sim
+	if ap.Rand == nil {
+		ap.Rand = sim.Rand
+	}
+}
+
 func NewPoissonArrProc(mean float64) (ap *PoissonArrProc) {
 	return &PoissonArrProc{Mean: mean}
 }
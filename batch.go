@@ -0,0 +1,269 @@
+package qsim
+
+import (
+	"github.com/danslimmon/qsim/analysis"
+)
+
+// BatchService makes a Processor serve Jobs in batches, the way an oven
+// bakes a whole tray at once or a CI runner picks up several builds
+// together. Create one with NewBatchService.
+//
+// BatchService is the Processor's Discipline. Jobs wait in Queue until the
+// Processor is empty and either at least Min of them are waiting or the one
+// at the head of the Queue has waited Timeout ticks. Then up to Max of them
+// are started together, all with the same processing time, which is given
+// by ServiceTime and may depend on the size of the batch. They all finish
+// together, too: the Processor's Finish callbacks run for each Job, and
+// once the last one has finished, the AfterRelease callbacks run for the
+// whole batch.
+//
+// Since the Processor has free slots between batches, the Jobs should be
+// put in Queue by an arrival behavior that never starts them on a Processor
+// directly, such as AlwaysQueueArrBeh.
+type BatchService struct {
+	Queue     *Queue
+	Processor *Processor
+	// Min and Max are the smallest and largest number of Jobs in a batch.
+	// A batch smaller than Min is only started once Timeout has expired. If
+	// Max is 0, there's no largest: every Job in the Queue goes in the
+	// batch, and the Processor's Capacity is set to fit it.
+	Min int
+	Max int
+	// Timeout is the longest the Job at the head of the Queue will wait
+	// for a batch to fill up; once it's waited this long, the next batch
+	// starts as soon as the Processor is empty, however small it is. The
+	// default, -1, means there's no timeout.
+	Timeout int
+	// ServiceTime returns the processing time for a batch. It should be
+	// positive.
+	ServiceTime func(batch []*Job) int
+	// Batches is the number of batches that have been started, and
+	// BatchSizes holds the size of each one.
+	Batches    int
+	BatchSizes analysis.Tally
+
+	sim *Simulation
+	// The batch in service, the Jobs in it that have yet to be started or
+	// finished, and its processing time.
+	batch    []*Job
+	pending  []*Job
+	started  int
+	released int
+	procTime int
+	// The event that wakes the Processor up when the head of the Queue
+	// times out.
+	timer *EventHandle
+	// Callback lists
+	cbBeforeBatch   []func(b *BatchService, batch []*Job)
+	cbAfterBatch    []func(b *BatchService, batch []*Job, procTime int)
+	cbBeforeRelease []func(b *BatchService, batch []*Job)
+	cbAfterRelease  []func(b *BatchService, batch []*Job)
+}
+
+// Next returns the next Job of the batch that's being started. If the
+// Processor is empty and a new batch is ready, Next forms it first.
+// Otherwise it returns nil.
+func (b *BatchService) Next(p *Processor) *Job {
+	var j *Job
+	if len(b.pending) == 0 {
+		if p.InService() > 0 || !b.ready() {
+			return nil
+		}
+		b.form()
+	}
+	j, b.pending = b.pending[0], b.pending[1:]
+	return j
+}
+
+// ready returns true if a new batch should be started.
+func (b *BatchService) ready() bool {
+	var n int
+	n = b.Queue.Length()
+	if n == 0 {
+		return false
+	}
+	if n >= b.Min {
+		return true
+	}
+	return b.Timeout >= 0 && b.sim != nil &&
+		b.sim.clock-b.Queue.Jobs[0].EnqueueTime >= b.Timeout
+}
+
+// form takes the next batch out of the Queue.
+func (b *BatchService) form() {
+	var j *Job
+	var n int
+	n = b.Queue.Length()
+	if b.Max > 0 && n > b.Max {
+		n = b.Max
+	}
+	if b.Max <= 0 {
+		b.Processor.Capacity = n
+	}
+	b.batch = make([]*Job, 0, n)
+	for len(b.batch) < n {
+		j, _ = b.Queue.Shift()
+		b.batch = append(b.batch, j)
+	}
+	b.pending = append([]*Job(nil), b.batch...)
+	b.started, b.released = 0, 0
+	b.beforeBatch(b.batch)
+	b.procTime = b.ServiceTime(b.batch)
+	D("Processor", b.Processor.ProcessorId, "formed a batch of", n, "Jobs")
+	b.armTimer()
+}
+
+// armTimer arranges for the Processor to be woken up when the Job at the
+// head of the Queue times out, calling off any earlier wake-up. It's called
+// again whenever a Job leaves the Queue, since the head may have changed.
+func (b *BatchService) armTimer() {
+	var t int
+	if b.timer != nil {
+		b.timer.Cancel()
+		b.timer = nil
+	}
+	if b.sim == nil || b.Timeout < 0 || b.Queue.Length() == 0 {
+		return
+	}
+	t = maxInt(b.Queue.Jobs[0].EnqueueTime+b.Timeout, b.sim.clock)
+	b.timer = b.sim.ScheduleAt(t, func(clock int) {
+		b.timer = nil
+		if b.Processor == nil || !b.Processor.IsIdle() {
+			// The Processor will look at the Queue again once it's free.
+			return
+		}
+		b.Processor.Pull()
+		// If no batch was formed and none is in service, the Job the timer
+		// was set for must have left the Queue, so wait for the new head
+		// instead.
+		if b.timer == nil && b.Processor.InService() == 0 {
+			b.armTimer()
+		}
+	})
+}
+
+// Attach makes p the Processor that serves the batches.
+func (b *BatchService) Attach(p *Processor) {
+	b.Processor = p
+}
+
+// Detach takes p away, if it's the Processor that serves the batches.
+func (b *BatchService) Detach(p *Processor) {
+	if b.Processor == p {
+		b.Processor = nil
+	}
+}
+
+// BeforeBatch adds a callback to be run immediately before a batch is
+// started.
+//
+// The callback will be passed the BatchService itself and the Jobs in the
+// batch, which have been taken out of the Queue but not started yet.
+func (b *BatchService) BeforeBatch(f func(b *BatchService, batch []*Job)) {
+	b.cbBeforeBatch = append(b.cbBeforeBatch, f)
+}
+func (b *BatchService) beforeBatch(batch []*Job) {
+	for _, cb := range b.cbBeforeBatch {
+		cb(b, batch)
+	}
+}
+
+// AfterBatch adds a callback to be run immediately after all the Jobs in a
+// batch have been started.
+//
+// The callback will be passed the BatchService itself, the Jobs in the
+// batch, and the batch's processing time.
+func (b *BatchService) AfterBatch(f func(b *BatchService, batch []*Job, procTime int)) {
+	b.cbAfterBatch = append(b.cbAfterBatch, f)
+}
+func (b *BatchService) afterBatch(batch []*Job, procTime int) {
+	for _, cb := range b.cbAfterBatch {
+		cb(b, batch, procTime)
+	}
+}
+
+// BeforeRelease adds a callback to be run immediately before the first Job
+// in a batch is finished.
+//
+// The callback will be passed the BatchService itself and the Jobs in the
+// batch, all of which are still in service.
+func (b *BatchService) BeforeRelease(f func(b *BatchService, batch []*Job)) {
+	b.cbBeforeRelease = append(b.cbBeforeRelease, f)
+}
+func (b *BatchService) beforeRelease(batch []*Job) {
+	for _, cb := range b.cbBeforeRelease {
+		cb(b, batch)
+	}
+}
+
+// AfterRelease adds a callback to be run immediately after the last Job in
+// a batch is finished.
+//
+// The callback will be passed the BatchService itself and the Jobs in the
+// batch. By the time it runs, the Processor's AfterFinish callbacks have
+// run for every Job in the batch, but the next batch hasn't been started.
+func (b *BatchService) AfterRelease(f func(b *BatchService, batch []*Job)) {
+	b.cbAfterRelease = append(b.cbAfterRelease, f)
+}
+func (b *BatchService) afterRelease(batch []*Job) {
+	for _, cb := range b.cbAfterRelease {
+		cb(b, batch)
+	}
+}
+
+func (b *BatchService) bindSimulation(sim *Simulation) {
+	b.sim = sim
+}
+
+// NewBatchService makes p serve the Jobs in q in batches of min to max
+// Jobs, each of which takes serviceTime to process. If max is 0, batches
+// have no largest size. p's Capacity is set to max, and its processing
+// times come from serviceTime from now on.
+func NewBatchService(q *Queue, p *Processor, min, max int, serviceTime func(batch []*Job) int) *BatchService {
+	var b *BatchService
+
+	b = &BatchService{Queue: q, Min: min, Max: max, Timeout: -1, ServiceTime: serviceTime}
+	p.Capacity = max
+	p.SetProcTimeGenerator(func(j *Job) int { return b.procTime })
+	p.SetDiscipline(b)
+
+	p.AfterStart(func(cbProc *Processor, cbJob *Job, cbProcTime int) {
+		if cbJob == nil || b.started == len(b.batch) {
+			return
+		}
+		b.started++
+		if b.started == len(b.batch) {
+			b.Batches++
+			b.BatchSizes.Add(float64(len(b.batch)))
+			b.afterBatch(b.batch, b.procTime)
+		}
+	})
+	p.BeforeFinish(func(cbProc *Processor, cbJob *Job) {
+		if cbJob != nil && b.released == 0 {
+			b.beforeRelease(b.batch)
+		}
+	})
+	p.AfterFinish(func(cbProc *Processor, cbJob *Job) {
+		if cbJob == nil {
+			return
+		}
+		b.released++
+		if b.released == len(b.batch) {
+			D("Processor", cbProc.ProcessorId, "released a batch of", len(b.batch), "Jobs")
+			b.afterRelease(b.batch)
+		}
+	})
+	q.AfterAppend(func(cbQueue *Queue, cbJob *Job) {
+		if cbJob != nil && b.timer == nil {
+			b.armTimer()
+		}
+	})
+	afterLeave := func(cbQueue *Queue, cbJob *Job) {
+		if cbJob != nil {
+			b.armTimer()
+		}
+	}
+	q.AfterShift(afterLeave)
+	q.AfterRemove(afterLeave)
+	return b
+}
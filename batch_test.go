@@ -0,0 +1,149 @@
+package qsim
+
+import (
+	"testing"
+)
+
+// batchSystem has a batch Processor that serves between 3 and Max Jobs at a
+// time, with arrivals every Interval ticks. A batch of n Jobs takes 20+5n
+// ticks.
+type batchSystem struct {
+	funcSystem
+	Interval, Timeout, Max int
+
+	Batch *BatchService
+	Stats *ProcessorStats
+	// The number of Jobs released in batches.
+	Released int
+	// Whether any batch was the wrong size, or didn't start and finish
+	// together.
+	BadBatch bool
+}
+
+func (sys *batchSystem) Init() {
+	var q *Queue
+	var p *Processor
+	var aqab *AlwaysQueueArrBeh
+	q = NewQueue()
+	p = NewProcessor(simplePtg)
+	sys.Batch = NewBatchService(q, p, 3, sys.Max, func(batch []*Job) int { return 20 + 5*len(batch) })
+	sys.Batch.Timeout = sys.Timeout
+	sys.Procs = []*Processor{p}
+	sys.AP = NewConstantArrProc(sys.Interval)
+	aqab = NewAlwaysQueueArrBeh(q, sys.AP).(*AlwaysQueueArrBeh)
+	aqab.Processors = sys.Procs
+	sys.AB = aqab
+	sys.Stats = NewProcessorStats(sys.Sim, p, 0)
+	sys.Batch.AfterRelease(func(b *BatchService, batch []*Job) {
+		sys.Released += len(batch)
+		if (sys.Max > 0 && len(batch) > sys.Max) || (sys.Timeout < 0 && len(batch) < 3) {
+			sys.BadBatch = true
+		}
+		for _, j := range batch {
+			if j.StartTime != batch[0].StartTime || j.DepartTime-j.StartTime != 20+5*len(batch) {
+				sys.BadBatch = true
+			}
+		}
+	})
+}
+
+// Tests that Jobs are served in batches of the right size, and that every
+// Job in a batch is started and finished together.
+func TestBatchService(t *testing.T) {
+	t.Parallel()
+	var sys *batchSystem
+	var ps *ProcessorStats
+
+	sys = &batchSystem{Interval: 10, Timeout: -1, Max: 5}
+	RunSimulation(sys, 10000, WithSeed(1))
+	ps = sys.Stats
+
+	if sys.BadBatch {
+		t.Log("Expected batches of 3 to 5 Jobs that start and finish together")
+		t.Fail()
+	}
+	if sys.Released != ps.Completed || sys.Released < 990 {
+		t.Log("Expected about 1000 Jobs to be released in batches but got", sys.Released, "of", ps.Completed)
+		t.Fail()
+	}
+	if sys.Batch.Batches < 150 || sys.Batch.BatchSizes.Mean() < 3 {
+		t.Log("Expected at least 150 batches of at least 3 Jobs but got", sys.Batch.Batches, "with mean size", sys.Batch.BatchSizes.Mean())
+		t.Fail()
+	}
+}
+
+// Tests that a batch starts short of Min once the Job at the head of the
+// Queue has waited for Timeout ticks.
+func TestBatchServiceTimeout(t *testing.T) {
+	t.Parallel()
+	var sys *batchSystem
+	var ps *ProcessorStats
+
+	sys = &batchSystem{Interval: 100, Timeout: 50, Max: 5}
+	RunSimulation(sys, 10000, WithSeed(1))
+	ps = sys.Stats
+
+	if sys.BadBatch || sys.Batch.BatchSizes.Max() != 1 || sys.Batch.Batches < 99 {
+		t.Log("Expected every Job to be served alone but got", sys.Batch.Batches, "batches with a largest of", sys.Batch.BatchSizes.Max())
+		t.Fail()
+	}
+	if ps.Waits.Min() != 50 || ps.Waits.Max() != 50 {
+		t.Log("Expected every Job to wait 50 ticks but waits ranged from", ps.Waits.Min(), "to", ps.Waits.Max())
+		t.Fail()
+	}
+}
+
+// Tests that with no Max, every Job waiting goes in the next batch, and all
+// of them are started together.
+func TestBatchServiceUnbounded(t *testing.T) {
+	t.Parallel()
+	var sys *batchSystem
+	var ps *ProcessorStats
+
+	sys = &batchSystem{Interval: 8, Timeout: -1, Max: 0}
+	RunSimulation(sys, 10000, WithSeed(1))
+	ps = sys.Stats
+
+	if sys.BadBatch {
+		t.Log("Expected batches of at least 3 Jobs that start and finish together")
+		t.Fail()
+	}
+	if sys.Released != ps.Completed || sys.Released < 1230 {
+		t.Log("Expected about 1250 Jobs to be released in batches but got", sys.Released, "of", ps.Completed)
+		t.Fail()
+	}
+	if sys.Batch.Batches < 2 || sys.Batch.BatchSizes.Max() <= 5 {
+		t.Log("Expected more than one batch, and batches bigger than 5, but got", sys.Batch.Batches, "with a largest of", sys.Batch.BatchSizes.Max())
+		t.Fail()
+	}
+}
+
+// Tests that when the Job at the head of the Queue leaves before it times
+// out, the timeout is counted from the new head instead.
+func TestBatchServiceTimeoutHeadLeaves(t *testing.T) {
+	t.Parallel()
+	var sys *funcSystem
+	var q *Queue
+	var j0, j1 *Job
+
+	sys = &funcSystem{InitFunc: func(sys *funcSystem) {
+		var p *Processor
+		var b *BatchService
+		q = NewQueue()
+		p = NewProcessor(simplePtg)
+		b = NewBatchService(q, p, 3, 5, func(batch []*Job) int { return 20 })
+		b.Timeout = 10
+		sys.Procs = []*Processor{p}
+		sys.AP = NewConstantArrProc(100000)
+		j0, j1 = sys.Sim.NewJob(), sys.Sim.NewJob()
+		sys.Sim.ScheduleAt(1, func(clock int) { q.Append(j0) })
+		sys.Sim.ScheduleAt(3, func(clock int) { q.Remove(j0) })
+		sys.Sim.ScheduleAt(5, func(clock int) { q.Append(j1) })
+	}}
+	RunSimulation(sys, 500, WithSeed(1))
+
+	if j0.StartTime != -1 || j1.StartTime != 15 {
+		t.Log("Expected the second Job to start alone at tick 15 but it started at", j1.StartTime)
+		t.Fail()
+	}
+}
@@ -0,0 +1,62 @@
+package qsim
+
+// Breakdowns makes a Processor fail and get repaired over and over, at
+// random: a register that jams, or a build agent that crashes. Create one
+// with NewBreakdowns.
+//
+// The time until each failure is measured from the end of the previous
+// repair (or from the creation of the Breakdowns, for the first failure).
+// What happens to the Jobs in service when the Processor fails is up to its
+// FailPolicy. To find out how available the Processor was, use
+// ProcessorStats.
+type Breakdowns struct {
+	// The Processor that breaks down.
+	Processor *Processor
+	// TimeToFailure returns the number of ticks until the Processor's next
+	// failure. If it returns a negative number, the Processor won't fail
+	// again.
+	TimeToFailure func(p *Processor) int
+	// TimeToRepair returns the number of ticks the Processor will spend
+	// down.
+	TimeToRepair func(p *Processor) int
+
+	sim *Simulation
+	// The next failure or repair.
+	next *EventHandle
+}
+
+// scheduleFailure arranges for the Processor's next failure.
+func (b *Breakdowns) scheduleFailure() {
+	var ttf int
+	ttf = b.TimeToFailure(b.Processor)
+	if ttf < 0 {
+		b.next = nil
+		return
+	}
+	b.next = b.sim.ScheduleAfter(ttf, func(clock int) {
+		b.Processor.Fail()
+		b.next = b.sim.ScheduleAfter(b.TimeToRepair(b.Processor), func(clock int) {
+			b.Processor.Repair()
+			b.scheduleFailure()
+		})
+	})
+}
+
+// Stop calls off the Processor's next failure. If the Processor is down,
+// it's left that way; call Repair on it if you want it back.
+func (b *Breakdowns) Stop() {
+	if b.next != nil {
+		b.next.Cancel()
+		b.next = nil
+	}
+}
+
+// NewBreakdowns starts making p fail and get repaired in sim, with times to
+// failure and times to repair drawn from ttf and ttr.
+func NewBreakdowns(sim *Simulation, p *Processor, ttf, ttr func(p *Processor) int) *Breakdowns {
+	var b *Breakdowns
+
+	b = &Breakdowns{Processor: p, TimeToFailure: ttf, TimeToRepair: ttr, sim: sim}
+	b.scheduleFailure()
+	return b
+}
@@ -0,0 +1,79 @@
+package qsim
+
+import (
+	"math"
+	"testing"
+)
+
+// breakdownSystem has a single 10-tick Processor, with arrivals every 20
+// ticks, that works for 90 ticks and then spends 10 down.
+type breakdownSystem struct {
+	funcSystem
+	Policy FailPolicy
+
+	Stats *ProcessorStats
+	// Whether a Job ever finished while the Processor was down.
+	FinishedWhileDown bool
+}
+
+func (sys *breakdownSystem) Init() {
+	q, p := newStation(10)
+	p.FailPolicy = sys.Policy
+	p.AfterFinish(func(p *Processor, j *Job) {
+		if p.IsDown() {
+			sys.FinishedWhileDown = true
+		}
+	})
+	sys.Procs = []*Processor{p}
+	sys.AP = NewConstantArrProc(20)
+	sys.AB = NewSharedQueueArrBeh(q, sys.Procs, sys.AP)
+	sys.Stats = NewProcessorStats(sys.Sim, p, 0)
+	NewBreakdowns(sys.Sim, p,
+		func(p *Processor) int { return 90 },
+		func(p *Processor) int { return 10 })
+}
+
+// Tests that a Processor that breaks down is available 90% of the time and
+// never finishes Jobs while it's down.
+func TestBreakdowns(t *testing.T) {
+	t.Parallel()
+	var sys *breakdownSystem
+	var ps *ProcessorStats
+
+	sys = &breakdownSystem{Policy: FailResume}
+	RunSimulation(sys, 10000, WithSeed(1))
+	ps = sys.Stats
+
+	if math.Abs(ps.Availability()-0.9) > 0.002 || ps.Failures != 100 {
+		t.Log("Expected 100 failures and 90% availability but got", ps.Failures, "and", ps.Availability())
+		t.Fail()
+	}
+	if sys.FinishedWhileDown {
+		t.Log("A Job finished while the Processor was down")
+		t.Fail()
+	}
+	if ps.Lost != 0 || ps.Completed < 495 {
+		t.Log("Expected about 500 Jobs to finish and none to be lost but got", ps.Completed, "and", ps.Lost)
+		t.Fail()
+	}
+}
+
+// Tests that Jobs in service are counted as lost under FailLose.
+func TestBreakdownsLose(t *testing.T) {
+	t.Parallel()
+	var sys *breakdownSystem
+	var ps *ProcessorStats
+
+	sys = &breakdownSystem{Policy: FailLose}
+	RunSimulation(sys, 10000, WithSeed(1))
+	ps = sys.Stats
+
+	if ps.Lost == 0 || ps.Lost > ps.Failures {
+		t.Log("Expected up to one Job to be lost per failure but got", ps.Lost, "in", ps.Failures, "failures")
+		t.Fail()
+	}
+	if sys.FinishedWhileDown {
+		t.Log("A Job finished while the Processor was down")
+		t.Fail()
+	}
+}
@@ -0,0 +1,168 @@
+package qsim
+
+import (
+	"math/rand"
+
+	"github.com/danslimmon/qsim/analysis"
+)
+
+// ClosedArrProc is the arrival process for a closed queueing network: a
+// fixed population of Jobs (say, a pool of test machines) that circulate
+// through the system forever instead of arriving from outside and leaving.
+// Create one with NewClosedArrProc.
+//
+// All of the Jobs arrive at the first tick. From then on, whenever a Job
+// reaches the end of its cycle (that is, whenever the Router would have had
+// it leave the system), it spends ThinkTime away and then arrives all over
+// again, as a new cycle, with its ArrTime set to the time it came back and
+// its Visits cleared. The ClosedArrProc hands it to the ArrBeh through its
+// AfterArrive callbacks, just as it did at the start. The Router's
+// Departed and Sojourns then count the cycles and the time each one took,
+// not including think time.
+//
+// Nothing that happens before the WarmUp tick is counted in the
+// ClosedArrProc's statistics.
+type ClosedArrProc struct {
+	// Population is the number of Jobs in the network.
+	Population int
+	// ThinkTime returns the number of ticks j spends away between the end
+	// of one cycle and the start of the next. If ThinkTime is nil, Jobs
+	// start their next cycle right away.
+	ThinkTime func(j *Job) int
+	// Rand is the source of JobIds for the Jobs. When the ClosedArrProc
+	// is part of a Simulation, Rand defaults to the Simulation's Rand.
+	Rand *rand.Rand
+	// WarmUp is the tick at which collection begins.
+	WarmUp int
+
+	// Jobs is the population, in the order the Jobs were created.
+	Jobs []*Job
+	// Cycles is the number of cycles the Jobs have completed.
+	Cycles int
+	// CycleTimes holds the duration of each completed cycle, from the
+	// time the Job arrived to the time it arrived again, think time
+	// included. CycleTimeQuantiles holds the same observations, for
+	// estimating percentiles.
+	CycleTimes         analysis.Tally
+	CycleTimeQuantiles analysis.Sketch
+
+	// The Simulation we're part of, if any.
+	sim *Simulation
+	// The number of Jobs that are thinking.
+	thinking int
+
+	// Callback lists
+	cbBeforeArrive []func(ap ArrProc)
+	cbAfterArrive  []func(ap ArrProc, jobs []*Job, interval int)
+}
+
+// Arrive creates the whole population of Jobs. It returns an interval of
+// -1, since no more Jobs will ever arrive from outside.
+//
+// clock is the current simulation clock time.
+func (ap *ClosedArrProc) Arrive(clock int) (jobs []*Job, interval int) {
+	var i int
+	ap.beforeArrive()
+	for i = 0; i < ap.Population; i++ {
+		jobs = append(jobs, newJob(clock, ap.Rand, ap.sim))
+	}
+	ap.Jobs = append(ap.Jobs, jobs...)
+	interval = -1
+	ap.afterArrive(jobs, interval)
+	return
+}
+
+// cycle is called when j reaches the end of a cycle. It sends j off to
+// think, and then has it arrive again.
+func (ap *ClosedArrProc) cycle(j *Job) {
+	var think int
+	if ap.ThinkTime != nil {
+		think = ap.ThinkTime(j)
+	}
+	if think <= 0 {
+		ap.rearrive(j)
+		return
+	}
+	ap.thinking++
+	ap.sim.ScheduleAfter(think, func(clock int) {
+		ap.thinking--
+		ap.rearrive(j)
+	})
+}
+
+// rearrive starts j on a new cycle.
+func (ap *ClosedArrProc) rearrive(j *Job) {
+	var now int
+	now = ap.sim.clock
+	if now >= ap.WarmUp {
+		ap.Cycles++
+		ap.CycleTimes.Add(float64(now - j.ArrTime))
+		ap.CycleTimeQuantiles.Add(float64(now - j.ArrTime))
+	}
+	ap.beforeArrive()
+	j.reset()
+	j.ArrTime = now
+	j.Visits = nil
+	D("Job", j.JobId, "started a new cycle")
+	ap.afterArrive([]*Job{j}, -1)
+}
+
+// Thinking returns the number of Jobs that are between cycles.
+func (ap *ClosedArrProc) Thinking() int {
+	return ap.thinking
+}
+
+// Throughput returns the number of cycles completed per tick since WarmUp.
+func (ap *ClosedArrProc) Throughput() float64 {
+	var elapsed int
+	elapsed = ap.sim.clock - ap.WarmUp
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(ap.Cycles) / float64(elapsed)
+}
+
+// BeforeArrive adds a callback to run immediately before the Arrival Process
+// creates the population, and before each Job starts a new cycle. This
+// callback is passed the ArrProc itself.
+func (ap *ClosedArrProc) BeforeArrive(f func(ArrProc)) {
+	ap.cbBeforeArrive = append(ap.cbBeforeArrive, f)
+}
+func (ap *ClosedArrProc) beforeArrive() {
+	for _, cb := range ap.cbBeforeArrive {
+		cb(ap)
+	}
+}
+
+// AfterArrive adds a callback to run immediately after the Arrival Process
+// creates the population, and after each Job starts a new cycle. This
+// callback is passed the ArrProc itself, the Jobs that arrived, and an
+// interval of -1.
+func (ap *ClosedArrProc) AfterArrive(f func(ArrProc, []*Job, int)) {
+	ap.cbAfterArrive = append(ap.cbAfterArrive, f)
+}
+func (ap *ClosedArrProc) afterArrive(jobs []*Job, interval int) {
+	for _, cb := range ap.cbAfterArrive {
+		cb(ap, jobs, interval)
+	}
+}
+
+func (ap *ClosedArrProc) bindSimulation(sim *Simulation) {
+	ap.sim = sim
+	if ap.Rand == nil {
+		ap.Rand = sim.Rand
+	}
+}
+
+// NewClosedArrProc returns a new ClosedArrProc with the given Population.
+// Jobs that r would send out of the system start a new cycle instead.
+func NewClosedArrProc(population int, r *Router) (ap *ClosedArrProc) {
+	ap = new(ClosedArrProc)
+	ap.Population = population
+	r.AfterRoute(func(cbRouter *Router, cbJob *Job, cbDest Destination) {
+		if cbDest.IsExit() {
+			ap.cycle(cbJob)
+		}
+	})
+	return ap
+}
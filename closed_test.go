@@ -0,0 +1,113 @@
+package qsim
+
+import (
+	"math"
+	"testing"
+)
+
+// Tests a closed network of 5 Jobs that take turns at a single 10-tick
+// station and think for 40 ticks in between. The station is never idle,
+// so the throughput is 1/10 and each cycle takes 5*10 = 50 ticks.
+func TestClosedArrProc(t *testing.T) {
+	t.Parallel()
+	var sys *funcSystem
+	var ap *ClosedArrProc
+	var q *Queue
+	var p *Processor
+	var r *Router
+
+	sys = &funcSystem{InitFunc: func(sys *funcSystem) {
+		q, p = newStation(10)
+		sys.Procs = []*Processor{p}
+		r = NewRouter(sys.Sim, sys.Procs, FixedRouting{}, 100)
+		ap = NewClosedArrProc(5, r)
+		ap.ThinkTime = func(j *Job) int { return 40 }
+		ap.WarmUp = 100
+		sys.AP = ap
+		sys.AB = NewSharedQueueArrBeh(q, sys.Procs, sys.AP)
+	}}
+	RunSimulation(sys, 10000, WithSeed(1))
+
+	if len(ap.Jobs) != 5 || ap.Thinking()+q.Length()+p.InService() != 5 {
+		t.Log("Expected all 5 Jobs to be thinking, queued, or in service but", ap.Thinking(), "are thinking,", q.Length(), "queued, and", p.InService(), "in service")
+		t.Fail()
+	}
+	if math.Abs(ap.Throughput()-0.1) > 0.001 {
+		t.Log("Expected throughput of 0.1 but got", ap.Throughput())
+		t.Fail()
+	}
+	if ap.CycleTimes.Mean() != 50 || ap.CycleTimes.Min() != 50 {
+		t.Log("Expected every cycle to take 50 ticks but got mean", ap.CycleTimes.Mean(), "and min", ap.CycleTimes.Min())
+		t.Fail()
+	}
+	// Minus think time, that's 10 ticks of service and 0 of waiting.
+	if r.Sojourns.Mean() != 10 || r.Visits.Mean() != 1 {
+		t.Log("Expected the Router to see 10-tick cycles with 1 visit but got", r.Sojourns.Mean(), "and", r.Visits.Mean())
+		t.Fail()
+	}
+	for _, j := range ap.Jobs {
+		if len(j.Visits) > 1 {
+			t.Log("Visits should be cleared at the start of each cycle, but Job has", len(j.Visits))
+			t.Fail()
+		}
+	}
+}
+
+// Tests that without think time, Jobs cycle straight back through a pair of
+// stations, and the population stays the same.
+func TestClosedArrProcNoThinkTime(t *testing.T) {
+	t.Parallel()
+	var sys *funcSystem
+	var ap *ClosedArrProc
+	var run, repair *Processor
+	var runQ, repairQ *Queue
+
+	sys = &funcSystem{InitFunc: func(sys *funcSystem) {
+		runQ, run = newStation(30)
+		repairQ, repair = newStation(20)
+		run.Capacity = 2
+		sys.Procs = []*Processor{run, repair}
+		r := NewRouter(sys.Sim, sys.Procs, FixedRouting{run: {Queue: repairQ}}, 0)
+		ap = NewClosedArrProc(4, r)
+		sys.AP = ap
+		sys.AB = NewAlwaysQueueArrBeh(runQ, sys.AP)
+		sys.AB.(*AlwaysQueueArrBeh).Processors = sys.Procs
+	}}
+	RunSimulation(sys, 10000, WithSeed(1))
+
+	if runQ.Length()+run.InService()+repairQ.Length()+repair.InService() != 4 {
+		t.Log("Expected the population of 4 to be conserved")
+		t.Fail()
+	}
+	// The repair station is the bottleneck, at one Job every 20 ticks.
+	if math.Abs(ap.Throughput()-0.05) > 0.001 {
+		t.Log("Expected throughput of 0.05 but got", ap.Throughput())
+		t.Fail()
+	}
+}
+
+// Tests that a closed network with nobody in it runs out of events without
+// panicking, and that Run just stops where it is.
+func TestClosedArrProcEmpty(t *testing.T) {
+	t.Parallel()
+	var sys *funcSystem
+	var sim *Simulation
+	var finalTick int
+
+	sys = &funcSystem{InitFunc: func(sys *funcSystem) {
+		q, p := newStation(10)
+		sys.Procs = []*Processor{p}
+		r := NewRouter(sys.Sim, sys.Procs, FixedRouting{}, 0)
+		sys.AP = NewClosedArrProc(0, r)
+		sys.AB = NewSharedQueueArrBeh(q, sys.Procs, sys.AP)
+	}}
+	sim = NewSimulation(sys, WithSeed(1))
+	if finalTick = sim.Run(1000); finalTick != 0 {
+		t.Log("Expected an empty closed network to stop at tick 0 but it stopped at", finalTick)
+		t.Fail()
+	}
+	if finalTick = sim.Run(2000); finalTick != 0 || sys.Procs[0].InService() != 0 {
+		t.Log("Expected Run to stop at tick 0 again but it stopped at", finalTick)
+		t.Fail()
+	}
+}
@@ -1,6 +1,33 @@
 package qsim
 
-type Discipline interface{}
+// A Discipline decides which Job a Processor should work on next.
+//
+// Each Processor may have a Discipline, set with Processor.SetDiscipline.
+// Whenever the Processor has room for another Job (after it finishes one,
+// when the simulation starts, or when a Job is queued by an arrival
+// behavior) it calls Next to find out what to start. A Discipline may be
+// shared by many Processors.
+type Discipline interface {
+	// Next removes the Job that p should start next from wherever it's
+	// waiting and returns it. If there's nothing for p to do, Next returns
+	// nil.
+	Next(p *Processor) *Job
+	// Attach is called when the Discipline is given to p.
+	Attach(p *Processor)
+	// Detach is called when p's Discipline is replaced by another one.
+	Detach(p *Processor)
+}
+
+// pullIdle asks each idle Processor in procs to start whatever Jobs its
+// Discipline has for it.
+func pullIdle(procs []*Processor) {
+	var p *Processor
+	for _, p = range procs {
+		if p.IsIdle() {
+			p.Pull()
+		}
+	}
+}
 
 // OneToOneFIFODiscipline moves Jobs from Queues to Processors based on
 // the following algorithm:
@@ -13,27 +40,56 @@ type Discipline interface{}
 type OneToOneFIFODiscipline struct {
 	Queues     []*Queue
 	Processors []*Processor
+
+	// The Queue that each Processor pulls from.
+	queueFor map[*Processor]*Queue
 }
 
 // AssignQueueToProcessor assigns a given Queue to a given Processor. That
 // Processor pull Jobs from that Queue, and only from that Queue.
 func (d *OneToOneFIFODiscipline) AssignQueueToProcessor(q *Queue, p *Processor) {
-	cbAfterFinish := func(cbProc *Processor, cbJob *Job) {
-		var j *Job
-		j, _ = q.Shift()
+	if d.queueFor == nil {
+		d.queueFor = make(map[*Processor]*Queue)
+	}
+	if old, ok := d.queueFor[p]; ok {
+		d.Queues = removeQueue(d.Queues, old)
+	}
+	d.queueFor[p] = q
+	d.Queues = append(d.Queues, q)
+	p.SetDiscipline(d)
+}
 
-		if j != nil {
-			cbProc.Start(j)
-		}
+// Next shifts the Job at the head of p's Queue.
+func (d *OneToOneFIFODiscipline) Next(p *Processor) *Job {
+	var q *Queue
+	var j *Job
+	q = d.queueFor[p]
+	if q == nil {
+		return nil
+	}
+	j, _ = q.Shift()
 
-		// Debug output
-		if j == nil {
-			D("Processor", cbProc.ProcessorId, "finished job", cbJob.JobId, "and now its Queue", q.QueueId, "is empty")
-		} else {
-			D("Processor", cbProc.ProcessorId, "finished job", cbJob.JobId, "and began Job", j.JobId, "from Queue", q.QueueId)
-		}
+	// Debug output
+	if j == nil {
+		D("Processor", p.ProcessorId, "is ready for work and its Queue", q.QueueId, "is empty")
+	} else {
+		D("Processor", p.ProcessorId, "is ready for work and began Job", j.JobId, "from Queue", q.QueueId)
 	}
-	p.AfterFinish(cbAfterFinish)
+	return j
+}
+
+// Attach adds p to the list of Processors.
+func (d *OneToOneFIFODiscipline) Attach(p *Processor) {
+	d.Processors = append(d.Processors, p)
+}
+
+// Detach removes p and its Queue.
+func (d *OneToOneFIFODiscipline) Detach(p *Processor) {
+	var q *Queue
+	q = d.queueFor[p]
+	delete(d.queueFor, p)
+	d.Processors = removeProcessor(d.Processors, p)
+	d.Queues = removeQueue(d.Queues, q)
 }
 
 // Generates a OneToOneFIFODiscipline given the Queues and Processors that
@@ -49,3 +105,178 @@ func NewOneToOneFIFODiscipline(queues []*Queue, procs []*Processor) Discipline {
 	}
 	return d
 }
+
+// SharedQueueDiscipline moves Jobs from a single Queue to any number of
+// Processors, like the line at a bank:
+//
+// – All the Processors pull Jobs from the same Queue.
+// – When a Processor finishes a Job, the Job at the head of the Queue is
+//   started on that Processor.
+// – If a Processor finishes a Job when the Queue is empty, it stays idle.
+//
+// Pair it with an arrival behavior that starts Jobs on any idle Processor,
+// such as the one made by NewSharedQueueArrBeh.
+type SharedQueueDiscipline struct {
+	Queue      *Queue
+	Processors []*Processor
+}
+
+// AddProcessor makes the given Processor pull Jobs from the shared Queue.
+func (d *SharedQueueDiscipline) AddProcessor(p *Processor) {
+	p.SetDiscipline(d)
+}
+
+// Next shifts the Job at the head of the shared Queue.
+func (d *SharedQueueDiscipline) Next(p *Processor) *Job {
+	var j *Job
+	j, _ = d.Queue.Shift()
+
+	// Debug output
+	if j == nil {
+		D("Processor", p.ProcessorId, "is ready for work and the shared Queue", d.Queue.QueueId, "is empty")
+	} else {
+		D("Processor", p.ProcessorId, "is ready for work and began Job", j.JobId, "from shared Queue", d.Queue.QueueId)
+	}
+	return j
+}
+
+// Attach adds p to the list of Processors.
+func (d *SharedQueueDiscipline) Attach(p *Processor) {
+	d.Processors = append(d.Processors, p)
+}
+
+// Detach removes p from the list of Processors.
+func (d *SharedQueueDiscipline) Detach(p *Processor) {
+	d.Processors = removeProcessor(d.Processors, p)
+}
+
+// NewSharedQueueDiscipline generates a SharedQueueDiscipline in which all
+// of procs pull Jobs from q.
+func NewSharedQueueDiscipline(q *Queue, procs []*Processor) Discipline {
+	var p *Processor
+	var d *SharedQueueDiscipline
+
+	d = new(SharedQueueDiscipline)
+	d.Queue = q
+	for _, p = range procs {
+		d.AddProcessor(p)
+	}
+	return d
+}
+
+// ClassBatchingDiscipline moves Jobs from a single Queue to any number of
+// Processors, like SharedQueueDiscipline, but it keeps each Processor on
+// the same Class of Job for as long as it can. This cuts down on setups
+// when switching Classes takes time (see Processor.Setup):
+//
+// – When a Processor is ready for work, it takes the first Job in the Queue
+//   whose Class matches that of the last Job it started.
+// – If there isn't one, or the Processor has already served MaxRun Jobs of
+//   that Class in a row, the Queue picks the next Job as usual.
+type ClassBatchingDiscipline struct {
+	Queue      *Queue
+	Processors []*Processor
+	// MaxRun is the most Jobs of one Class a Processor will pick out of
+	// the Queue in a row, so that Jobs of other Classes don't wait
+	// forever. If MaxRun is 0, there's no limit.
+	MaxRun int
+
+	// The number of Jobs of the same Class each Processor has started in
+	// a row.
+	runs map[*Processor]int
+}
+
+// AddProcessor makes the given Processor pull Jobs from the Queue.
+func (d *ClassBatchingDiscipline) AddProcessor(p *Processor) {
+	p.SetDiscipline(d)
+}
+
+// Next shifts the first Job in the Queue of the same Class as the last one
+// p started, or the Job the Queue would shift next if there isn't one.
+func (d *ClassBatchingDiscipline) Next(p *Processor) *Job {
+	var i int
+	var j *Job
+	if d.MaxRun <= 0 || d.runs[p] < d.MaxRun {
+		for i, j = range d.Queue.Jobs {
+			if j.Class == p.LastClass() {
+				break
+			}
+		}
+	}
+	if j == nil || j.Class != p.LastClass() {
+		j, _ = d.Queue.Shift()
+	} else {
+		d.Queue.shiftAt(i)
+	}
+
+	// Debug output
+	if j == nil {
+		D("Processor", p.ProcessorId, "is ready for work and the shared Queue", d.Queue.QueueId, "is empty")
+		return nil
+	}
+	D("Processor", p.ProcessorId, "is ready for work and began Job", j.JobId, "of Class", j.Class, "from shared Queue", d.Queue.QueueId)
+	d.makeRuns()
+	if j.Class == p.LastClass() {
+		d.runs[p]++
+	} else {
+		d.runs[p] = 1
+	}
+	return j
+}
+
+// makeRuns makes the map of runs, if the ClassBatchingDiscipline wasn't
+// built by NewClassBatchingDiscipline.
+func (d *ClassBatchingDiscipline) makeRuns() {
+	if d.runs == nil {
+		d.runs = make(map[*Processor]int)
+	}
+}
+
+// Attach adds p to the list of Processors.
+func (d *ClassBatchingDiscipline) Attach(p *Processor) {
+	d.makeRuns()
+	d.Processors = append(d.Processors, p)
+}
+
+// Detach removes p from the list of Processors.
+func (d *ClassBatchingDiscipline) Detach(p *Processor) {
+	d.Processors = removeProcessor(d.Processors, p)
+	delete(d.runs, p)
+}
+
+// NewClassBatchingDiscipline generates a ClassBatchingDiscipline in which
+// all of procs pull Jobs from q.
+func NewClassBatchingDiscipline(q *Queue, procs []*Processor) *ClassBatchingDiscipline {
+	var p *Processor
+	var d *ClassBatchingDiscipline
+
+	d = new(ClassBatchingDiscipline)
+	d.Queue = q
+	d.makeRuns()
+	for _, p = range procs {
+		d.AddProcessor(p)
+	}
+	return d
+}
+
+// removeProcessor returns procs without p.
+func removeProcessor(procs []*Processor, p *Processor) []*Processor {
+	var i int
+	for i = range procs {
+		if procs[i] == p {
+			return append(procs[:i], procs[i+1:]...)
+		}
+	}
+	return procs
+}
+
+// removeQueue returns queues without q.
+func removeQueue(queues []*Queue, q *Queue) []*Queue {
+	var i int
+	for i = range queues {
+		if queues[i] == q {
+			return append(queues[:i], queues[i+1:]...)
+		}
+	}
+	return queues
+}
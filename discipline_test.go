@@ -52,3 +52,259 @@ func TestOneToOneFIFODiscipline(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// Tests the behavior of a SharedQueueDiscipline
+func TestSharedQueueDiscipline(t *testing.T) {
+	t.Parallel()
+	var q *Queue
+	var procs []*Processor
+	var jobs []*Job
+	var i int
+
+	q = NewQueue()
+	for i = 0; i < 3; i++ {
+		procs = append(procs, NewProcessor(simplePtg))
+		procs[i].ProcessorId = i
+		procs[i].Start(NewJob(0))
+	}
+	NewSharedQueueDiscipline(q, procs)
+	for i = 0; i < 4; i++ {
+		jobs = append(jobs, NewJob(0))
+		q.Append(jobs[i])
+	}
+
+	// Whichever Processor finishes first gets the oldest Job in the Queue.
+	procs[2].Finish()
+	procs[0].Finish()
+	if procs[2].CurrentJob != jobs[0] || procs[0].CurrentJob != jobs[1] {
+		t.Log("Processors should've been assigned the oldest Jobs in the shared Queue, in the order they finished")
+		t.Fail()
+	}
+	if q.Length() != 2 {
+		t.Log("Expected 2 Jobs left in the shared Queue but found", q.Length())
+		t.Fail()
+	}
+
+	// Once the Queue is empty, Processors stay idle.
+	procs[1].Finish()
+	procs[1].Finish()
+	procs[1].Finish()
+	if !procs[1].IsIdle() || q.Length() != 0 {
+		t.Log("Processor should be idle after the shared Queue ran dry")
+		t.Fail()
+	}
+}
+
+// Tests that pooling two servers behind one Queue gives shorter waits than
+// giving each server its own Queue, all else being equal.
+func TestSharedQueueDisciplinePooling(t *testing.T) {
+	t.Parallel()
+	var pooled, split *SystemStats
+
+	run := func(shared bool) *SystemStats {
+		var ss *SystemStats
+		sys := &funcSystem{InitFunc: func(sys *funcSystem) {
+			var queues []*Queue
+			ptg := func(j *Job) int {
+				return int(sys.Sim.Rand.ExpFloat64() * 1800)
+			}
+			sys.Procs = []*Processor{NewProcessor(ptg), NewProcessor(ptg)}
+			sys.AP = NewPoissonArrProc(1000)
+			if shared {
+				queues = []*Queue{NewQueue()}
+				sys.AB = NewSharedQueueArrBeh(queues[0], sys.Procs, sys.AP)
+				NewSharedQueueDiscipline(queues[0], sys.Procs)
+			} else {
+				queues = []*Queue{NewQueue(), NewQueue()}
+				sys.AB = NewShortestQueueArrBeh(queues, sys.Procs, sys.AP)
+				NewOneToOneFIFODiscipline(queues, sys.Procs)
+			}
+			ss = NewSystemStats(sys.Sim, queues, sys.Procs, 0)
+		}}
+		RunSimulation(sys, 5000000, WithSeed(9))
+		return ss
+	}
+	pooled = run(true)
+	split = run(false)
+
+	pooledWaits, splitWaits := pooled.Waits(), split.Waits()
+	if pooledWaits.Mean() >= splitWaits.Mean() {
+		t.Log("Expected pooled servers to have shorter waits, but pooled mean wait was", pooledWaits.Mean(), "and split was", splitWaits.Mean())
+		t.Fail()
+	}
+	if pooled.Queues[0].Dropped != 0 || pooled.Completed() < 4900 {
+		t.Log("Pooled system didn't serve all its Jobs; completed", pooled.Completed())
+		t.Fail()
+	}
+}
+
+// stackDiscipline is a Discipline for tests. It hands out Jobs from a slice,
+// last in first out, and keeps track of which Processors it's attached to.
+type stackDiscipline struct {
+	Jobs     []*Job
+	Attached map[*Processor]bool
+}
+
+func (d *stackDiscipline) Next(p *Processor) *Job {
+	var j *Job
+	if len(d.Jobs) == 0 {
+		return nil
+	}
+	j = d.Jobs[len(d.Jobs)-1]
+	d.Jobs = d.Jobs[:len(d.Jobs)-1]
+	return j
+}
+func (d *stackDiscipline) Attach(p *Processor) { d.Attached[p] = true }
+func (d *stackDiscipline) Detach(p *Processor) { delete(d.Attached, p) }
+
+// Tests that a ClassBatchingDiscipline keeps a Processor on the same Class
+// of Job, up to MaxRun Jobs in a row, whether or not it's built by its
+// constructor.
+func TestClassBatchingDiscipline(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		maxRun  int
+		literal bool
+		order   []int
+	}{
+		{0, false, []int{0, 2, 4, 1, 3}},
+		{2, false, []int{0, 2, 1, 3, 4}},
+		{0, true, []int{0, 2, 4, 1, 3}},
+		{2, true, []int{0, 2, 1, 3, 4}},
+	}
+
+	for _, test := range tests {
+		var q *Queue
+		var p *Processor
+		var d *ClassBatchingDiscipline
+		var order []int
+		var i int
+
+		q = NewQueue()
+		for i = 0; i < 5; i++ {
+			j := NewJob(0)
+			j.Class = []string{"a", "b"}[i%2]
+			j.IntAttrs["n"] = i
+			q.Append(j)
+		}
+		p = NewProcessor(simplePtg)
+		p.BeforeStart(func(p *Processor, j *Job) {
+			order = append(order, j.IntAttrs["n"])
+		})
+		if test.literal {
+			d = &ClassBatchingDiscipline{Queue: q}
+			p.SetDiscipline(d)
+		} else {
+			d = NewClassBatchingDiscipline(q, []*Processor{p})
+		}
+		d.MaxRun = test.maxRun
+
+		p.Pull()
+		for i = 0; i < 4; i++ {
+			p.Finish()
+		}
+		if len(order) != len(test.order) {
+			t.Log("Expected Jobs to be started in the order", test.order, "but got", order)
+			t.Fail()
+			continue
+		}
+		for i = range order {
+			if order[i] != test.order[i] {
+				t.Log("Expected Jobs to be started in the order", test.order, "but got", order)
+				t.Fail()
+				break
+			}
+		}
+	}
+}
+
+// Tests that Processors consult their Discipline when they have room for
+// another Job.
+func TestProcessorDiscipline(t *testing.T) {
+	t.Parallel()
+	var d0, d1 *stackDiscipline
+	var p *Processor
+	var jobs []*Job
+	var i int
+
+	for i = 0; i < 4; i++ {
+		jobs = append(jobs, NewJob(0))
+	}
+	d0 = &stackDiscipline{Jobs: jobs, Attached: make(map[*Processor]bool)}
+	p = NewProcessor(simplePtg)
+	p.Capacity = 2
+	p.SetDiscipline(d0)
+	if !d0.Attached[p] || p.Discipline() != d0 {
+		t.Log("SetDiscipline didn't attach the Discipline")
+		t.Fail()
+	}
+
+	// Pull fills all the free slots.
+	if n := p.Pull(); n != 2 || p.Jobs[0] != jobs[3] || p.Jobs[1] != jobs[2] {
+		t.Log("Expected Pull to start the last two Jobs but it started", n, "Jobs:", p.Jobs)
+		t.Fail()
+	}
+	// Finishing a Job pulls the next one.
+	p.FinishJob(jobs[2])
+	if p.InService() != 2 || p.Jobs[1] != jobs[1] {
+		t.Log("Finishing a Job didn't pull the next one from the Discipline")
+		t.Fail()
+	}
+
+	// Replacing the Discipline detaches the old one.
+	d1 = &stackDiscipline{Attached: make(map[*Processor]bool)}
+	p.SetDiscipline(d1)
+	if d0.Attached[p] || !d1.Attached[p] {
+		t.Log("SetDiscipline didn't detach the old Discipline and attach the new one")
+		t.Fail()
+	}
+	p.Finish()
+	p.Finish()
+	if !p.IsIdle() || p.InService() != 0 || len(d0.Jobs) != 1 {
+		t.Log("Processor should have gone idle when its new Discipline ran out of Jobs")
+		t.Fail()
+	}
+}
+
+// Tests that Jobs queued before the Simulation starts, or queued while a
+// Processor is idle, get picked up by the Processor's Discipline.
+func TestDisciplineInSimulation(t *testing.T) {
+	t.Parallel()
+	var sys *funcSystem
+	var q *Queue
+	var starts []int
+
+	sys = &funcSystem{InitFunc: func(sys *funcSystem) {
+		q = NewQueue()
+		p := NewProcessor(func(j *Job) int { return 30 })
+		p.AfterStart(func(p *Processor, j *Job, procTime int) {
+			starts = append(starts, j.StartTime)
+		})
+		sys.Procs = []*Processor{p}
+		sys.AP = NewConstantArrProc(100)
+		sys.AB = &AlwaysQueueArrBeh{Q: q, Processors: sys.Procs}
+		sys.AP.AfterArrive(func(ap ArrProc, jobs []*Job, interval int) {
+			for _, j := range jobs {
+				sys.AB.Assign(j)
+			}
+		})
+		NewSharedQueueDiscipline(q, sys.Procs)
+		q.Append(sys.Sim.NewJob())
+		q.Append(sys.Sim.NewJob())
+	}}
+	RunSimulation(sys, 250, WithSeed(1))
+
+	// Two Jobs were waiting at the start; then one arrives every 100 ticks,
+	// the first of them while the Processor is still busy.
+	expStarts := []int{0, 30, 60, 100, 200}
+	if len(starts) < len(expStarts) {
+		t.Fatal("Expected Jobs to start at", expStarts, "but they started at", starts)
+	}
+	for i := range expStarts {
+		if starts[i] != expStarts[i] {
+			t.Log("Expected Jobs to start at", expStarts, "but they started at", starts)
+			t.Fail()
+			break
+		}
+	}
+}
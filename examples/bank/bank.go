@@ -0,0 +1,116 @@
+package main
+
+/* Compares a bank where every teller has their own line with one where all
+ * the tellers share a single line, at a range of utilizations.
+ */
+
+import (
+	"fmt"
+
+	"github.com/danslimmon/qsim"
+)
+
+// BankSystem is a bank with a few tellers. If Pooled is true, customers wait
+// in a single line and go to whichever teller is free next; otherwise each
+// teller has their own line and customers join the shortest one.
+type BankSystem struct {
+	Pooled          bool
+	NumTellers      int
+	ArrivalInterval float64
+	ServiceTime     float64
+
+	// Stats about the lines and the tellers.
+	Stats *qsim.SystemStats
+
+	queues     []*qsim.Queue
+	processors []*qsim.Processor
+	arrProc    qsim.ArrProc
+	arrBeh     qsim.ArrBeh
+	sim        *qsim.Simulation
+}
+
+// SetSimulation gives us access to the Simulation's random number generator.
+func (sys *BankSystem) SetSimulation(sim *qsim.Simulation) {
+	sys.sim = sim
+}
+
+// Init runs before the simulation begins, and its job is to set up the
+// queues, processors, and behaviors.
+func (sys *BankSystem) Init() {
+	var i int
+	procTimeGenerator := func(j *qsim.Job) int {
+		return int(sys.sim.Rand.ExpFloat64() * sys.ServiceTime)
+	}
+	sys.arrProc = qsim.NewPoissonArrProc(sys.ArrivalInterval)
+	sys.processors = make([]*qsim.Processor, sys.NumTellers)
+	for i = 0; i < sys.NumTellers; i++ {
+		sys.processors[i] = qsim.NewProcessor(procTimeGenerator)
+	}
+
+	if sys.Pooled {
+		// One line feeding every teller.
+		sys.queues = []*qsim.Queue{qsim.NewQueue()}
+		sys.arrBeh = qsim.NewSharedQueueArrBeh(sys.queues[0], sys.processors, sys.arrProc)
+		qsim.NewSharedQueueDiscipline(sys.queues[0], sys.processors)
+	} else {
+		// A line for each teller.
+		sys.queues = make([]*qsim.Queue, sys.NumTellers)
+		for i = 0; i < sys.NumTellers; i++ {
+			sys.queues[i] = qsim.NewQueue()
+		}
+		sys.arrBeh = qsim.NewShortestQueueArrBeh(sys.queues, sys.processors, sys.arrProc)
+		qsim.NewOneToOneFIFODiscipline(sys.queues, sys.processors)
+	}
+
+	sys.Stats = qsim.NewSystemStats(sys.sim, sys.queues, sys.processors, 0)
+}
+
+// ArrProc returns the system's arrival process.
+func (sys *BankSystem) ArrProc() qsim.ArrProc {
+	return sys.arrProc
+}
+
+// ArrBeh returns the system's arrival behavior.
+func (sys *BankSystem) ArrBeh() qsim.ArrBeh {
+	return sys.arrBeh
+}
+
+// Processors returns the list of Processors in the system.
+func (sys *BankSystem) Processors() []*qsim.Processor {
+	return sys.processors
+}
+
+func (sys *BankSystem) BeforeFirstTick()       {}
+func (sys *BankSystem) BeforeEvents(clock int) {}
+func (sys *BankSystem) AfterEvents(clock int)  {}
+
+func main() {
+	var simTicks, numTellers int
+	var serviceTime, util float64
+
+	// Run each simulation for 8 hours (a tick represents a millisecond)
+	simTicks = 8 * 3600 * 1000
+	numTellers = 4
+	// Each customer takes 3 minutes on average
+	serviceTime = 180000.0
+
+	fmt.Printf("utilization,avg_wait_split,avg_wait_pooled,p90_wait_split,p90_wait_pooled\n")
+	for util = 0.5; util < 0.96; util += 0.05 {
+		var waits [2]float64
+		var p90s [2]float64
+		for i, pooled := range []bool{false, true} {
+			sys := &BankSystem{
+				Pooled:          pooled,
+				NumTellers:      numTellers,
+				ArrivalInterval: serviceTime / float64(numTellers) / util,
+				ServiceTime:     serviceTime,
+			}
+			qsim.RunSimulation(sys, simTicks)
+			w := sys.Stats.Waits()
+			q := sys.Stats.WaitQuantiles()
+			waits[i] = w.Mean() / 1000.0
+			p90s[i] = q.Quantile(0.9) / 1000.0
+		}
+		fmt.Printf("%0.2f,%0.1f,%0.1f,%0.1f,%0.1f\n", util, waits[0], waits[1], p90s[0], p90s[1])
+	}
+}
@@ -8,8 +8,6 @@ package main
 
 import (
 	"fmt"
-	"math/rand"
-	"time"
 
 	"github.com/danslimmon/qsim"
 )
@@ -26,28 +24,34 @@ type BlogSystem struct {
 	// The system's arrival behavior
 	arrBeh qsim.ArrBeh
 
-	IdleTime        int
 	ArrivalInterval float64
-	QueueSum        int
-	QueueCount      int
+	// Stats about the queue and the processor.
+	QueueStats     *qsim.QueueStats
+	ProcessorStats *qsim.ProcessorStats
 
-	prevClock int
+	sim *qsim.Simulation
+}
+
+// SetSimulation gives us access to the Simulation's random number generator.
+func (sys *BlogSystem) SetSimulation(sim *qsim.Simulation) {
+	sys.sim = sim
 }
 
 // Init runs before the simulation begins, and its job is to set up the
 // queues, processors, and behaviors.
 func (sys *BlogSystem) Init() {
 	var i int
-	rand.Seed(time.Now().UnixNano())
 	sys.arrProc = qsim.NewPoissonArrProc(sys.ArrivalInterval)
 	procTimeGenerator := func(j *qsim.Job) int {
-		return int(rand.ExpFloat64() * 1000.0)
+		return int(sys.sim.Rand.ExpFloat64() * 1000.0)
 	}
 	// There is 1 processor and 1 queue
 	sys.queues = make([]*qsim.Queue, 1)
 	sys.processors = make([]*qsim.Processor, 1)
 	sys.queues[i] = qsim.NewQueue()
 	sys.processors[i] = qsim.NewProcessor(procTimeGenerator)
+	sys.QueueStats = qsim.NewQueueStats(sys.sim, sys.queues[i], 0)
+	sys.ProcessorStats = qsim.NewProcessorStats(sys.sim, sys.processors[i], 0)
 	sys.arrBeh = qsim.NewShortestQueueArrBeh(sys.queues, sys.processors, sys.arrProc)
 	qsim.NewOneToOneFIFODiscipline(sys.queues, sys.processors)
 }
@@ -69,19 +73,12 @@ func (sys *BlogSystem) Processors() []*qsim.Processor {
 	return sys.processors
 }
 
-func (sys *BlogSystem) BeforeEvents(clock int) {
-	sys.QueueSum += sys.queues[0].Length()
-	sys.QueueCount++
-	if sys.processors[0].IsIdle() {
-		sys.IdleTime += clock - sys.prevClock
-	}
-	sys.prevClock = clock
-}
+func (sys *BlogSystem) BeforeEvents(clock int) {}
 
 func (sys *BlogSystem) AfterEvents(clock int) {}
 
 func main() {
-	var finalTick, simTicks int
+	var simTicks int
 
 	// Run the simulation for 24 hours (a tick represents a millisecond)
 	simTicks = 86400 * 1000
@@ -89,8 +86,8 @@ func main() {
 	fmt.Printf("arrival_interval,utilization,avg_queue\n")
 	for ai := 900; ai < 3000; ai += 50 {
 		sys := &BlogSystem{ArrivalInterval: float64(ai)}
-		finalTick = qsim.RunSimulation(sys, simTicks)
+		qsim.RunSimulation(sys, simTicks)
 		fmt.Printf("%d,%0.3f,%0.3f\n",
-			ai, 1.0-float64(sys.IdleTime)/float64(finalTick), float64(sys.QueueSum)/float64(sys.QueueCount))
+			ai, sys.ProcessorStats.Utilization(), sys.QueueStats.AvgLength())
 	}
 }
@@ -2,13 +2,12 @@ package main
 
 import (
 	"fmt"
-	"math/rand"
 	"os"
-	"sort"
 	"strconv"
 	"time"
 
 	"github.com/danslimmon/qsim"
+	"github.com/danslimmon/qsim/analysis"
 )
 
 type BloodBankArrProc struct {
@@ -35,7 +34,7 @@ func (arrProc *BloodBankArrProc) Arrive(clock int) (jobs []*qsim.Job, interval i
 			numToAppend = sys.MaxDrawRate * ((clock - sys.lastDraw) / 1440)
 		}
 		for i := 0; i < numToAppend; i++ {
-			jobs = append(jobs, qsim.NewJob(clock))
+			jobs = append(jobs, sys.sim.NewJob())
 		}
 		sys.lastDraw = clock
 	}
@@ -89,17 +88,23 @@ type BloodBankSystem struct {
 	NumTossed, NumUsed int
 	// The number of transfusions that had to be aborted due to a blood shortfall
 	NumAborted int
-	// The list of all ages of units used in transfusions (in ticks)
-	UnitAges []int
+	// The distribution of the ages of units used in transfusions (in ticks)
+	UnitAges analysis.Sketch
 	// For each age in Thresholds, the number of samples used that were older than
 	// that age.
 	AgeCounts []int
 
+	sim          *qsim.Simulation
 	statsStarted bool
-	unitsUsed    []*qsim.Job
 	lastDraw     int
 }
 
+// SetSimulation gives us access to the Simulation, which we use to schedule
+// the expiration of each unit and to draw random numbers.
+func (sys *BloodBankSystem) SetSimulation(sim *qsim.Simulation) {
+	sys.sim = sim
+}
+
 // Init runs before the simulation begins, and its job is to set up the
 // queues, processors, and behaviors.
 //
@@ -107,23 +112,23 @@ type BloodBankSystem struct {
 func (sys *BloodBankSystem) Init() {
 	var procMean float64
 
-	rand.Seed(time.Now().UnixNano())
 	// MeanTransfusionRate is in units/day, so the mean time between transfusions is
 	// the reciprocal of that, expressed in ticks/unit
 	procMean = 1440.0 / sys.MeanTransfusionRate
 	sys.MaxJobAge = 35 * 1440
 
 	sys.AgeCounts = make([]int, len(sys.Thresholds))
-	sys.unitsUsed = make([]*qsim.Job, 0)
 
 	transfusionIntervalGenerator := func(j *qsim.Job) int {
 		var r float64
-		r = rand.ExpFloat64() * procMean
+		r = sys.sim.Rand.ExpFloat64() * procMean
 		return int(r)
 	}
 
-	// There is only one queue, representing the fridge.
+	// There is only one queue, representing the fridge. Units arrive in
+	// order of age, so the youngest unit is the last one in.
 	sys.queue = qsim.NewQueue()
+	sys.queue.Ordering = qsim.LIFO
 
 	// There are two processors. One represents the trash can, and one represents
 	// transfusions.
@@ -133,8 +138,14 @@ func (sys *BloodBankSystem) Init() {
 	// Processor callbacks to keep track of stats.
 	sys.transfusionProcessor.AfterStart(func(p *qsim.Processor, j *qsim.Job, procTime int) {
 		if sys.statsStarted && j != nil && j.ArrTime != -1 {
+			age := j.StartTime - j.ArrTime
 			sys.NumUsed++
-			sys.unitsUsed = append(sys.unitsUsed, j)
+			sys.UnitAges.Add(float64(age))
+			for i, thresh := range sys.Thresholds {
+				if age > thresh {
+					sys.AgeCounts[i]++
+				}
+			}
 		}
 	})
 	sys.trashProcessor.AfterFinish(func(p *qsim.Processor, j *qsim.Job) {
@@ -143,11 +154,26 @@ func (sys *BloodBankSystem) Init() {
 		}
 	})
 
+	// When a unit goes into the fridge, schedule it to be sent to the trash
+	// once it reaches the maximum age. If it's been used by then, there's
+	// nothing to do.
+	sys.queue.AfterAppend(func(q *qsim.Queue, j *qsim.Job) {
+		if j == nil {
+			return
+		}
+		sys.sim.ScheduleAt(j.ArrTime+sys.MaxJobAge, func(clock int) {
+			if j, _ = sys.queue.Remove(j); j != nil {
+				sys.trashProcessor.Start(j)
+			}
+		})
+	})
+
 	sys.arrProc = &BloodBankArrProc{Sys: sys}
 	sys.arrBeh = qsim.NewAlwaysQueueArrBeh(sys.queue, sys.arrProc)
 
-	applyBloodBankDiscipline(sys, sys.queue, sys.trashProcessor, sys.transfusionProcessor)
-	sys.transfusionProcessor.Start(nil)
+	// The transfusion Processor is never idle: the discipline hands it a
+	// dummy Job when there's no blood. The Simulation gets it started.
+	sys.transfusionProcessor.SetDiscipline(&youngestFirstDiscipline{sys: sys, queue: sys.queue})
 }
 
 // ArrProc returns the system's arrival process.
@@ -166,25 +192,13 @@ func (sys *BloodBankSystem) Processors() []*qsim.Processor {
 }
 
 // BeforeRun runs right before the clock starts.
-func (sys *BloodBankSystem) BeforeFirstTick() {
-	sys.transfusionProcessor.Start(qsim.NewJob(0))
-}
+func (sys *BloodBankSystem) BeforeFirstTick() {}
 
 // BeforeEvents runs at every tick when a simulation event happens (a
 // Job arrives in the system, or a Job finishes processing and leaves
 // the system). BeforeEvents is called after all the events for the tick
 // in question have finished.
-//
-// In this example, we use BeforeEvents to send any jobs older than the
-// maximum age to the trash.
-func (sys *BloodBankSystem) BeforeEvents(clock int) {
-	for _, j := range sys.queue.Jobs {
-		if clock-j.ArrTime >= sys.MaxJobAge {
-			sys.queue.Remove(j)
-			sys.trashProcessor.Start(j)
-		}
-	}
-}
+func (sys *BloodBankSystem) BeforeEvents(clock int) {}
 
 // AfterEvents runs at every tick when a simulation event happens, but
 // in contrast with BeforeEvents, it runs after all the events for that
@@ -193,48 +207,37 @@ func (sys *BloodBankSystem) AfterEvents(clock int) {
 	if clock >= sys.StatsStart {
 		sys.statsStarted = true
 	}
-	if sys.statsStarted {
-		for _, j := range sys.unitsUsed {
-			sys.UnitAges = append(sys.UnitAges, clock-j.ArrTime)
-			for i, thresh := range sys.Thresholds {
-				if clock-j.ArrTime > thresh {
-					sys.AgeCounts[i]++
-				}
-			}
-		}
-		sys.unitsUsed = sys.unitsUsed[:0]
-	}
 }
 
-func applyBloodBankDiscipline(sys *BloodBankSystem, queue *qsim.Queue, trashProcessor, transfusionProcessor *qsim.Processor) {
-	// Assigns the youngest unit to the processor
-	assigner := func(cbProc *qsim.Processor, cbJob *qsim.Job) {
-		var i, iYoungest int
-		var j *qsim.Job
-		if queue.Length() == 0 {
-			qsim.D("Aborted after Job", cbJob)
-			if sys.statsStarted {
-				sys.NumAborted++
-			}
-			// Give the processor a dummy job until the next transfusion
-			j = qsim.NewJob(-1)
-			cbProc.Start(j)
-			return
-		}
-		for i, j = range queue.Jobs {
-			if j.ArrTime > queue.Jobs[iYoungest].ArrTime {
-				iYoungest = i
-			}
+// youngestFirstDiscipline gives the transfusion Processor the youngest unit
+// in the bank; the bank's Queue is LIFO, so that's whatever Shift returns.
+// If the bank is empty, the transfusion is aborted and the Processor gets a
+// dummy Job to keep it busy until the next transfusion.
+type youngestFirstDiscipline struct {
+	sys   *BloodBankSystem
+	queue *qsim.Queue
+}
+
+// Next picks the youngest unit in the bank.
+func (d *youngestFirstDiscipline) Next(p *qsim.Processor) *qsim.Job {
+	var j *qsim.Job
+	if d.queue.Length() == 0 {
+		qsim.D("Aborted transfusion")
+		if d.sys.statsStarted {
+			d.sys.NumAborted++
 		}
-		j = queue.Jobs[iYoungest]
-		queue.Remove(j)
-		cbProc.Start(j)
-		qsim.D("Started Job", j)
+		j = d.sys.sim.NewJob()
+		j.ArrTime = -1
+		return j
 	}
-
-	transfusionProcessor.AfterFinish(assigner)
+	j, _ = d.queue.Shift()
+	qsim.D("Started Job", j)
+	return j
 }
 
+func (d *youngestFirstDiscipline) Attach(p *qsim.Processor) {}
+func (d *youngestFirstDiscipline) Detach(p *qsim.Processor) {}
+
 // Simulates a blood bank.
 //
 // – Any blood unit older than 35 days is thrown in the trash.
@@ -261,20 +264,15 @@ func applyBloodBankDiscipline(sys *BloodBankSystem, queue *qsim.Queue, trashProc
 // - A value for each member of `thresholds` (see below) indicating the number of units
 //   used in transfusions over that age in days
 func SimBloodBank() {
-	var simTicks, nSims, simsPerCpu, statsStart int
+	var simTicks, nSims, statsStart int
 	var maxDrawRate, maxOccupancy int
 	var maxDrawRate64, maxOccupancy64 int64
 	var meanTransfusionRate float64
-	type simResult struct {
-		Done                           bool
-		NumTossed, NumUsed, NumAborted int
-		UnitAges                       []int
-		AgeCounts                      []int
-	}
 	var nTossed, nUsed, nAborted int
-	var unitAges, ageCounts, thresholds []int
-	var ch chan simResult
-	var cpu, nCpu, routinesDone int
+	var ageCounts, thresholds []int
+	var unitAges analysis.Sketch
+	var reps qsim.Replications
+	var nCpu int
 	var err error
 
 	if len(os.Args) > 4 && os.Args[4] == "test" {
@@ -286,13 +284,10 @@ func SimBloodBank() {
 		nSims = 64
 		simTicks = 40 * 365 * 1440
 	}
-	simsPerCpu = nSims / nCpu
 	// Don't start collecting stats until a year goes by
 	statsStart = 365 * 1440
 
 	thresholds = []int{5 * 1440, 10 * 1440, 15 * 1440, 20 * 1440, 25 * 1440, 30 * 1440}
-	unitAges = make([]int, 0)
-	ageCounts = make([]int, len(thresholds))
 
 	maxDrawRate64, err = strconv.ParseInt(os.Args[1], 10, 0)
 	if err != nil {
@@ -309,60 +304,32 @@ func SimBloodBank() {
 		panic("Failed to parse mean transfusion rate")
 	}
 
-	ch = make(chan simResult)
-	for cpu = 0; cpu < nCpu; cpu++ {
-		go func(cpu int) {
-			var i int
-			for i = cpu*simsPerCpu + 1; i <= (cpu+1)*simsPerCpu; i++ {
-				var rslt simResult
-				rslt = simResult{
-					AgeCounts: make([]int, len(thresholds)),
-				}
-				var j int
-				for j = 0; j < simsPerCpu; j++ {
-					sys := &BloodBankSystem{
-						Thresholds:          thresholds,
-						StatsStart:          statsStart,
-						MaxDrawRate:         maxDrawRate,
-						MaxOccupancy:        maxOccupancy,
-						MeanTransfusionRate: meanTransfusionRate,
-					}
-					qsim.RunSimulation(sys, simTicks)
-
-					rslt.NumTossed += sys.NumTossed
-					rslt.NumUsed += sys.NumUsed
-					rslt.NumAborted += sys.NumAborted
-					rslt.UnitAges = append(rslt.UnitAges, sys.UnitAges...)
-					var k int
-					for k, _ = range rslt.AgeCounts {
-						rslt.AgeCounts[k] = sys.AgeCounts[k]
-					}
-				}
-				ch <- rslt
-			}
-			ch <- simResult{Done: true}
-		}(cpu)
+	factory := func(rep int) qsim.System {
+		return &BloodBankSystem{
+			Thresholds:          thresholds,
+			StatsStart:          statsStart,
+			MaxDrawRate:         maxDrawRate,
+			MaxOccupancy:        maxOccupancy,
+			MeanTransfusionRate: meanTransfusionRate,
+		}
 	}
+	reps = qsim.RunReplications(factory, nSims, simTicks, qsim.ReplicationOptions{
+		Workers: nCpu,
+		Seed:    time.Now().UnixNano(),
+	})
 
-	for routinesDone < nCpu {
-		var rslt simResult
-		rslt = <-ch
-		if rslt.Done {
-			routinesDone++
-			continue
-		}
-		nTossed += rslt.NumTossed
-		nUsed += rslt.NumUsed
-		nAborted += rslt.NumAborted
-		unitAges = append(unitAges, rslt.UnitAges...)
-		for i, _ := range thresholds {
-			ageCounts[i] += rslt.AgeCounts[i]
-		}
+	nTossed = reps.SumInt(func(sys qsim.System) int { return sys.(*BloodBankSystem).NumTossed })
+	nUsed = reps.SumInt(func(sys qsim.System) int { return sys.(*BloodBankSystem).NumUsed })
+	nAborted = reps.SumInt(func(sys qsim.System) int { return sys.(*BloodBankSystem).NumAborted })
+	ageCounts = reps.SumInts(func(sys qsim.System) []int { return sys.(*BloodBankSystem).AgeCounts })
+	for _, rep := range reps {
+		unitAges.Merge(&rep.Sys.(*BloodBankSystem).UnitAges)
 	}
 
-	sort.Ints(unitAges)
-	ind := int(9 * len(unitAges) / 10)
-	p90UnitAge := unitAges[ind]
+	p90UnitAge := 0
+	if unitAges.Count() > 0 {
+		p90UnitAge = int(unitAges.Quantile(0.9))
+	}
 
 	fmt.Printf("%d,%d,%d,%d,%d,%d",
 		(simTicks-statsStart)*nSims,
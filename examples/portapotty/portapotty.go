@@ -24,12 +24,16 @@ type PortaPottySystem struct {
 	// The system's arrival behavior
 	arrBeh qsim.ArrBeh
 
-	SumStrategizerWaits, SumNonStrategizerWaits int
-	NumStrategizers, NumNonStrategizers         int
+	// Stats about the porta-potties, broken down by whether people used the
+	// strategy ("strategy") or not ("no_strategy").
+	Stats *qsim.SystemStats
 
-	statsStarted bool
-	finishedJobs []*qsim.Job
-	prevClock    int
+	sim *qsim.Simulation
+}
+
+// SetSimulation gives us access to the Simulation's random number generator.
+func (sys *PortaPottySystem) SetSimulation(sim *qsim.Simulation) {
+	sys.sim = sim
 }
 
 // Init runs before the simulation begins, and its job is to set up the
@@ -37,8 +41,9 @@ type PortaPottySystem struct {
 func (sys *PortaPottySystem) Init() {
 	var i int
 	var maleMean, femaleMean, stdev float64
+	var rng *rand.Rand
 
-	rand.Seed(time.Now().UnixNano())
+	rng = sys.sim.Rand
 	maleMean = 40000.0
 	femaleMean = 60000.0
 	stdev = 5000.0
@@ -48,9 +53,9 @@ func (sys *PortaPottySystem) Init() {
 	procTimeGenerator := func(j *qsim.Job) int {
 		if j.StrAttrs["sex"] == "male" {
 			// Normal distribution of pee times with stdev=5s
-			return int(rand.NormFloat64()*stdev + maleMean)
+			return int(rng.NormFloat64()*stdev + maleMean)
 		} else {
-			return int(rand.NormFloat64()*stdev + femaleMean)
+			return int(rng.NormFloat64()*stdev + femaleMean)
 		}
 	}
 
@@ -63,17 +68,9 @@ func (sys *PortaPottySystem) Init() {
 		sys.processors[i] = qsim.NewProcessor(procTimeGenerator)
 	}
 
-	// Processor callback to keep track of wait times for strategy users and non
-	// strategy users. This saves finished Jobs to a slice so that we can do
-	// calculations on those Jobs after each tick in AfterEvents.
-	for i, _ = range sys.processors {
-		sys.processors[i].AfterFinish(func(p *qsim.Processor, j *qsim.Job) {
-			if !sys.statsStarted {
-				return
-			}
-			sys.finishedJobs = append(sys.finishedJobs, j)
-		})
-	}
+	// Keep track of wait times for strategy users and non strategy users,
+	// ignoring the initial transient behavior of the system.
+	sys.Stats = qsim.NewSystemStats(sys.sim, sys.queues, sys.processors, sys.StatsStart)
 
 	// The mean of this Poisson distribution is the maxmimum rate at which
 	// porta-potties can be vacated. This ensures that queues will usually be
@@ -82,14 +79,16 @@ func (sys *PortaPottySystem) Init() {
 	// Assign a gender to each incoming person.
 	sys.arrProc.AfterArrive(func(ap qsim.ArrProc, jobs []*qsim.Job, interval int) {
 		sexes := []string{"male", "female"}
-		jobs[0].StrAttrs["sex"] = sexes[rand.Intn(2)]
+		jobs[0].StrAttrs["sex"] = sexes[rng.Intn(2)]
 	})
 	// Occasionally pick a person to use the strategy.
 	sys.arrProc.AfterArrive(func(ap qsim.ArrProc, jobs []*qsim.Job, interval int) {
-		if rand.Float64() < sys.PStrategy {
+		if rng.Float64() < sys.PStrategy {
 			jobs[0].IntAttrs["use_strategy"] = 1
+			jobs[0].Class = "strategy"
 		} else {
 			jobs[0].IntAttrs["use_strategy"] = 0
+			jobs[0].Class = "no_strategy"
 		}
 	})
 
@@ -153,28 +152,7 @@ func (sys *PortaPottySystem) BeforeEvents(clock int) {}
 // AfterEvents runs at every tick when a simulation event happens, but
 // in contrast with BeforeEvents, it runs after all the events for that
 // tick have occurred.
-func (sys *PortaPottySystem) AfterEvents(clock int) {
-	var j *qsim.Job
-
-	// Ignore the initial transient behavior of the system
-	if clock < sys.StatsStart {
-		sys.prevClock = clock
-		return
-	}
-	sys.statsStarted = true
-
-	for _, j = range sys.finishedJobs {
-		if j.IntAttrs["use_strategy"] == 1 {
-			sys.SumStrategizerWaits += clock - j.ArrTime
-			sys.NumStrategizers++
-		} else {
-			sys.SumNonStrategizerWaits += clock - j.ArrTime
-			sys.NumNonStrategizers++
-		}
-	}
-	sys.finishedJobs = sys.finishedJobs[:0]
-	sys.prevClock = clock
-}
+func (sys *PortaPottySystem) AfterEvents(clock int) {}
 
 // strategicAssignment returns an Assignment corresponding to the following
 // wait-time reduction strategy:
@@ -225,7 +203,7 @@ func (sys *PortaPottySystem) strategicAssignment() *qsim.Assignment {
 
 	return &qsim.Assignment{
 		Type:  "Queue",
-		Queue: dudefulQueues[rand.Intn(len(dudefulQueues))],
+		Queue: dudefulQueues[sys.sim.Rand.Intn(len(dudefulQueues))],
 	}
 }
 
@@ -245,69 +223,58 @@ func (sys *PortaPottySystem) strategicAssignment() *qsim.Assignment {
 //   rounding error inherent in picking integer times from a continuous
 //   distribution.
 func SimPortaPotty() {
-	var simTicks, simsPerProb int
+	var simTicks, simsPerProb, nCpu, nProbs, i int
 	var probStep float64
-	type simResult struct {
-		Done                                        bool
-		PStrategy                                   float64
-		SumStrategizerWaits, SumNonStrategizerWaits int
-		NumStrategizers, NumNonStrategizers         int
-	}
-	var ch chan simResult
-	var cpu, nCpu, nProbs, probsPerCpu, routinesDone int
+	var seed int64
 
 	fmt.Println("pStrategy,avgStratWait,avgNonStratWait,avgWait")
 
 	nCpu = 5
 	nProbs = 100
 	probStep = .01
-	probsPerCpu = nProbs / nCpu
 	// Run each simulation for 14 days
 	simTicks = 14 * 86400 * 1000
 	simsPerProb = 40
-
-	ch = make(chan simResult)
-	for cpu = 0; cpu < nCpu; cpu++ {
-		go func(cpu int) {
-			var i int
-			for i = cpu*probsPerCpu + 1; i <= (cpu+1)*probsPerCpu; i++ {
-				var pStrategy float64
-				var rslt simResult
-				pStrategy = probStep * float64(i)
-				rslt = simResult{
-					Done:      false,
-					PStrategy: pStrategy,
-				}
-				var j int
-				for j = 0; j < simsPerProb; j++ {
-					sys := &PortaPottySystem{
-						PStrategy:  pStrategy,
-						StatsStart: 200000000,
-					}
-					qsim.RunSimulation(sys, simTicks)
-
-					rslt.SumStrategizerWaits += sys.SumStrategizerWaits
-					rslt.SumNonStrategizerWaits += sys.SumNonStrategizerWaits
-					rslt.NumStrategizers += sys.NumStrategizers
-					rslt.NumNonStrategizers += sys.NumNonStrategizers
-				}
-				ch <- rslt
+	seed = time.Now().UnixNano()
+
+	for i = 1; i <= nProbs; i++ {
+		var reps qsim.Replications
+		var pStrategy float64
+		var sumStrategizerWaits, sumNonStrategizerWaits float64
+		var numStrategizers, numNonStrategizers int
+
+		pStrategy = probStep * float64(i)
+		factory := func(rep int) qsim.System {
+			return &PortaPottySystem{
+				PStrategy:  pStrategy,
+				StatsStart: 200000000,
 			}
-			ch <- simResult{Done: true}
-		}(cpu)
-	}
+		}
+		reps = qsim.RunReplications(factory, simsPerProb, simTicks, qsim.ReplicationOptions{
+			Workers: nCpu,
+			Seed:    seed + int64(i),
+		})
 
-	for routinesDone < nCpu {
-		var rslt simResult
-		rslt = <-ch
-		if rslt.Done {
-			routinesDone++
-			continue
+		sumWaits := func(class string) float64 {
+			return reps.Sum(func(sys qsim.System) float64 {
+				js := sys.(*PortaPottySystem).Stats.Class(class)
+				return js.Sojourns.Sum()
+			})
+		}
+		numJobs := func(class string) int {
+			return reps.SumInt(func(sys qsim.System) int {
+				return sys.(*PortaPottySystem).Stats.Class(class).Completed
+			})
 		}
-		avgStrategizerWait := float64(rslt.SumStrategizerWaits) / float64(rslt.NumStrategizers)
-		avgNonStrategizerWait := float64(rslt.SumNonStrategizerWaits) / float64(rslt.NumNonStrategizers)
-		avgWait := float64(rslt.SumStrategizerWaits+rslt.SumNonStrategizerWaits) / float64(rslt.NumStrategizers+rslt.NumNonStrategizers)
-		fmt.Printf("%0.2f,%0.2f,%0.2f,%02.f\n", rslt.PStrategy, avgStrategizerWait/1000.0, avgNonStrategizerWait/1000.0, avgWait/1000.0)
+		sumStrategizerWaits = sumWaits("strategy")
+		sumNonStrategizerWaits = sumWaits("no_strategy")
+		numStrategizers = numJobs("strategy")
+		numNonStrategizers = numJobs("no_strategy")
+
+		avgStrategizerWait := sumStrategizerWaits / float64(numStrategizers)
+		avgNonStrategizerWait := sumNonStrategizerWaits / float64(numNonStrategizers)
+		avgWait := (sumStrategizerWaits + sumNonStrategizerWaits) / float64(numStrategizers+numNonStrategizers)
+		fmt.Printf("%0.2f,%0.2f,%0.2f,%02.f\n", pStrategy, avgStrategizerWait/1000.0, avgNonStrategizerWait/1000.0, avgWait/1000.0)
 	}
 }
 
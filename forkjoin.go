@@ -0,0 +1,320 @@
+package qsim
+
+import (
+	"github.com/danslimmon/qsim/analysis"
+)
+
+// A Fork splits each Job it's given into child Jobs, one for each of its
+// Branches, and sends the children on their way; a request that fans out
+// to several backend shards, say. The parent Job waits until a Join
+// releases it. Create one with NewFork.
+//
+// A Fork is an ArrBeh, so it can take Jobs straight from an ArrProc, or be
+// the Destination of a Router. Assign returns an Assignment whose Type is
+// "Fork".
+type Fork struct {
+	// Branches are the Destinations the children are sent to. Each one
+	// gets a child of its own.
+	Branches []Destination
+	// Processors that should be woken up when a child is sent straight to
+	// a Queue.
+	Processors []*Processor
+	// Forked is the number of Jobs that have been split.
+	Forked int
+
+	sim *Simulation
+	// Callback lists
+	cbBeforeAssign []func(ab ArrBeh, j *Job) *Assignment
+	cbAfterAssign  []func(ab ArrBeh, j *Job, ass Assignment)
+}
+
+// Assign splits j into children and sends them to the Fork's Branches.
+//
+// Each child arrives at the current time and inherits j's Priority, Class,
+// ServiceEstimate, Deadline, and a copy of its attributes.
+func (f *Fork) Assign(j *Job) Assignment {
+	var ass Assignment
+	var assPtr *Assignment
+	var child *Job
+	var i int
+
+	// Allow beforeAssign callback to override the assignment logic
+	assPtr = f.beforeAssign(j)
+	if assPtr != nil {
+		f.assign(j, *assPtr)
+		f.afterAssign(j, *assPtr)
+		return *assPtr
+	}
+
+	ass = Assignment{Type: "Fork"}
+	j.Children = make([]*Job, 0, len(f.Branches))
+	for range f.Branches {
+		child = f.sim.NewJob()
+		child.Parent = j
+		child.Priority = j.Priority
+		child.Class = j.Class
+		child.ServiceEstimate = j.ServiceEstimate
+		child.Deadline = j.Deadline
+		for k, v := range j.IntAttrs {
+			child.IntAttrs[k] = v
+		}
+		for k, v := range j.StrAttrs {
+			child.StrAttrs[k] = v
+		}
+		j.Children = append(j.Children, child)
+	}
+	f.Forked++
+	D("Job", j.JobId, "was forked into", len(j.Children), "children")
+	for i, child = range j.Children {
+		send(f.sim, child, f.Branches[i], f.Processors)
+	}
+	f.afterAssign(j, ass)
+	return ass
+}
+
+// assign does the appropriate thing with the Job given an Assignment.
+func (f *Fork) assign(j *Job, ass Assignment) {
+	switch ass.Type {
+	case "Queue":
+		ass.Queue.Append(j)
+		pullIdle(f.Processors)
+	case "Processor":
+		ass.Processor.Start(j)
+	default:
+		panic("Tried to process Assignment with unknown Type '" + ass.Type + "'")
+	}
+}
+
+// BeforeAssign adds a callback to run immediately before the Fork splits a
+// Job. The callback is passed the Fork itself as well as the Job.
+//
+// The callback may return an Assignment pointer, of Type "Queue" or
+// "Processor", to send the Job there whole instead of splitting it.
+// Otherwise, if the callback returns <nil>, the Job is split as usual.
+func (f *Fork) BeforeAssign(cb func(ArrBeh, *Job) *Assignment) {
+	f.cbBeforeAssign = append(f.cbBeforeAssign, cb)
+}
+func (f *Fork) beforeAssign(j *Job) *Assignment {
+	var assPtr, newAssPtr *Assignment
+	for _, cb := range f.cbBeforeAssign {
+		newAssPtr = cb(f, j)
+		if newAssPtr != nil {
+			assPtr = newAssPtr
+		}
+	}
+	return assPtr
+}
+
+// AfterAssign adds a callback to run immediately after the Fork has split a
+// Job and sent its children on their way. The callback is passed the Fork
+// itself, the parent Job, and the Assignment.
+func (f *Fork) AfterAssign(cb func(ArrBeh, *Job, Assignment)) {
+	f.cbAfterAssign = append(f.cbAfterAssign, cb)
+}
+func (f *Fork) afterAssign(j *Job, ass Assignment) {
+	for _, cb := range f.cbAfterAssign {
+		cb(f, j, ass)
+	}
+}
+
+func (f *Fork) bindSimulation(sim *Simulation) {
+	f.sim = sim
+}
+
+// NewFork creates a Fork in sim that sends one child of each Job to each
+// of branches. Jobs that arrive from ap are split automatically; ap may be
+// nil for a Fork that only takes Jobs forwarded by a Router.
+func NewFork(sim *Simulation, branches []Destination, ap ArrProc) *Fork {
+	var f *Fork
+
+	f = &Fork{Branches: branches, sim: sim}
+	if ap != nil {
+		ap.AfterArrive(func(cbArrProc ArrProc, cbJobs []*Job, cbInterval int) {
+			for _, j := range cbJobs {
+				f.Assign(j)
+			}
+		})
+	}
+	return f
+}
+
+// A Join collects the children that a Fork split a Job into, and releases
+// the parent once enough of them have arrived. Create one with NewJoin.
+//
+// A Join is an ArrBeh: send the children to it, usually with a Router
+// whose Destination for each of the Fork's stations is the Join. Assign
+// returns an Assignment whose Type is "Join". Children that arrive after
+// their parent has been released are discarded.
+//
+// Nothing that happens before the WarmUp tick is counted in the Join's
+// statistics.
+type Join struct {
+	// K is the number of children that must arrive before the parent is
+	// released. If K is 0 (or more than the number of children), the
+	// parent waits for all of them.
+	K int
+	// Then is where the parent goes once it's released. The zero
+	// Destination means it leaves the system.
+	Then Destination
+	// Processors that should be woken up when a released parent is sent
+	// straight to a Queue.
+	Processors []*Processor
+	// WarmUp is the tick at which collection begins.
+	WarmUp int
+
+	// Released is the number of parents that have been released.
+	Released int
+	// SyncDelays holds the synchronization delay for each released parent:
+	// the time between the arrival of its first child at the Join and its
+	// release. SyncDelayQuantiles holds the same observations, for
+	// estimating percentiles.
+	SyncDelays         analysis.Tally
+	SyncDelayQuantiles analysis.Sketch
+	// Sojourns holds the time between each released parent's arrival and
+	// its release.
+	Sojourns analysis.Tally
+
+	sim *Simulation
+	// For each parent that's still waiting, the number of children that
+	// have arrived and when the first of them did.
+	waiting map[*Job]*joinState
+	// Callback lists
+	cbBeforeAssign []func(ab ArrBeh, j *Job) *Assignment
+	cbAfterAssign  []func(ab ArrBeh, j *Job, ass Assignment)
+}
+
+// joinState keeps track of the children of one parent.
+type joinState struct {
+	arrived   int
+	firstTime int
+	released  bool
+}
+
+// Assign takes in a child Job, and releases its parent if enough of the
+// parent's children have now arrived. Assign panics if j has no parent.
+func (jn *Join) Assign(j *Job) Assignment {
+	var ass Assignment
+	var assPtr *Assignment
+
+	// Allow beforeAssign callback to override the assignment logic
+	assPtr = jn.beforeAssign(j)
+	if assPtr != nil {
+		jn.assign(j, *assPtr)
+		jn.afterAssign(j, *assPtr)
+		return *assPtr
+	}
+
+	ass = Assignment{Type: "Join"}
+	jn.assign(j, ass)
+	jn.afterAssign(j, ass)
+	return ass
+}
+
+// assign does the appropriate thing with the Job given an Assignment.
+func (jn *Join) assign(j *Job, ass Assignment) {
+	switch ass.Type {
+	case "Join":
+		jn.join(j)
+	case "Queue":
+		ass.Queue.Append(j)
+		pullIdle(jn.Processors)
+	case "Processor":
+		ass.Processor.Start(j)
+	default:
+		panic("Tried to process Assignment with unknown Type '" + ass.Type + "'")
+	}
+}
+
+// join notes the arrival of child j, releasing its parent if it's time.
+func (jn *Join) join(j *Job) {
+	var parent *Job
+	var st *joinState
+	var k, now int
+
+	parent = j.Parent
+	if parent == nil {
+		panic("Join was given a Job that didn't come from a Fork")
+	}
+	now = jn.sim.clock
+	st = jn.waiting[parent]
+	if st == nil {
+		st = &joinState{firstTime: now}
+		jn.waiting[parent] = st
+	}
+	st.arrived++
+	if st.arrived == len(parent.Children) {
+		delete(jn.waiting, parent)
+	}
+	if st.released {
+		D("Job", j.JobId, "arrived at Join after its parent was released")
+		return
+	}
+
+	k = jn.K
+	if k <= 0 || k > len(parent.Children) {
+		k = len(parent.Children)
+	}
+	if st.arrived < k {
+		return
+	}
+	st.released = true
+	parent.DepartTime = now
+	D("Job", parent.JobId, "was released by Join after", st.arrived, "children arrived")
+	if now >= jn.WarmUp {
+		jn.Released++
+		jn.SyncDelays.Add(float64(now - st.firstTime))
+		jn.SyncDelayQuantiles.Add(float64(now - st.firstTime))
+		jn.Sojourns.Add(float64(parent.SystemTime()))
+	}
+	if !jn.Then.IsExit() {
+		parent.forward()
+		send(jn.sim, parent, jn.Then, jn.Processors)
+	}
+}
+
+// BeforeAssign adds a callback to run immediately before a child Job
+// arrives at the Join. The callback is passed the Join itself as well as
+// the child.
+//
+// The callback may return an Assignment pointer, of Type "Queue" or
+// "Processor", to send the child there instead. Otherwise, if the callback
+// returns <nil>, the child joins as usual.
+func (jn *Join) BeforeAssign(cb func(ArrBeh, *Job) *Assignment) {
+	jn.cbBeforeAssign = append(jn.cbBeforeAssign, cb)
+}
+func (jn *Join) beforeAssign(j *Job) *Assignment {
+	var assPtr, newAssPtr *Assignment
+	for _, cb := range jn.cbBeforeAssign {
+		newAssPtr = cb(jn, j)
+		if newAssPtr != nil {
+			assPtr = newAssPtr
+		}
+	}
+	return assPtr
+}
+
+// AfterAssign adds a callback to run immediately after a child Job has
+// arrived at the Join (and its parent has been released, if it was time).
+// The callback is passed the Join itself, the child, and the Assignment.
+func (jn *Join) AfterAssign(cb func(ArrBeh, *Job, Assignment)) {
+	jn.cbAfterAssign = append(jn.cbAfterAssign, cb)
+}
+func (jn *Join) afterAssign(j *Job, ass Assignment) {
+	for _, cb := range jn.cbAfterAssign {
+		cb(jn, j, ass)
+	}
+}
+
+func (jn *Join) bindSimulation(sim *Simulation) {
+	jn.sim = sim
+}
+
+// NewJoin creates a Join in sim that releases each parent once k of its
+// children have arrived (or all of them, if k is 0) and sends it to then.
+func NewJoin(sim *Simulation, k int, then Destination, warmUp int) *Join {
+	var jn *Join
+
+	jn = &Join{K: k, Then: then, WarmUp: warmUp, sim: sim}
+	jn.waiting = make(map[*Job]*joinState)
+	return jn
+}
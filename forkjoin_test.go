@@ -0,0 +1,122 @@
+package qsim
+
+import (
+	"testing"
+)
+
+// forkJoinSystem fans each Job out to three shards that take 10, 20, and 30
+// ticks, and joins the children back up once K of them are done.
+type forkJoinSystem struct {
+	funcSystem
+	K int
+
+	Fork *Fork
+	Join *Join
+	// The parents the Join has released, in order.
+	Released []*Job
+}
+
+func (sys *forkJoinSystem) Init() {
+	var branches []Destination
+	var route FixedRouting
+	route = make(FixedRouting)
+	sys.Join = NewJoin(sys.Sim, sys.K, Destination{}, 0)
+	for _, procTime := range []int{10, 20, 30} {
+		q, p := newStation(procTime)
+		sys.Procs = append(sys.Procs, p)
+		branches = append(branches, Destination{Queue: q})
+		route[p] = Destination{ArrBeh: sys.Join}
+	}
+	sys.AP = NewConstantArrProc(100)
+	sys.Fork = NewFork(sys.Sim, branches, sys.AP)
+	sys.Fork.Processors = sys.Procs
+	sys.AB = sys.Fork
+	NewRouter(sys.Sim, sys.Procs, route, 0)
+	sys.Join.AfterAssign(func(ab ArrBeh, j *Job, ass Assignment) {
+		n := len(sys.Released)
+		if j.Parent.DepartTime != -1 && (n == 0 || sys.Released[n-1] != j.Parent) {
+			sys.Released = append(sys.Released, j.Parent)
+		}
+	})
+}
+
+// Tests that a Join waits for all the children by default.
+func TestForkJoinAll(t *testing.T) {
+	t.Parallel()
+	var sys *forkJoinSystem
+
+	sys = &forkJoinSystem{}
+	RunSimulation(sys, 1000, WithSeed(1))
+
+	if sys.Fork.Forked != 11 || sys.Join.Released != 10 || len(sys.Released) != 10 {
+		t.Log("Expected 11 Jobs to be forked and 10 released but got", sys.Fork.Forked, "and", sys.Join.Released)
+		t.Fail()
+	}
+	if sys.Join.SyncDelays.Mean() != 20 || sys.Join.Sojourns.Mean() != 30 {
+		t.Log("Expected a sync delay of 20 and sojourn of 30 but got", sys.Join.SyncDelays.Mean(), "and", sys.Join.Sojourns.Mean())
+		t.Fail()
+	}
+	for _, j := range sys.Procs[2].Jobs {
+		if len(j.Parent.Children) != 3 || j.Parent.Children[2] != j {
+			t.Log("Child Job doesn't know its parent")
+			t.Fail()
+		}
+	}
+	if len(sys.Join.waiting) != 1 {
+		t.Log("Only the Job that arrived at 1000 should still be waiting, but", len(sys.Join.waiting), "are")
+		t.Fail()
+	}
+}
+
+// Tests that a Join can release the parent once k of its children are done,
+// and discards the stragglers.
+func TestForkJoinKOfN(t *testing.T) {
+	t.Parallel()
+	var sys *forkJoinSystem
+
+	sys = &forkJoinSystem{K: 2}
+	RunSimulation(sys, 1000, WithSeed(1))
+
+	if sys.Join.Released != 10 || sys.Join.SyncDelays.Mean() != 10 || sys.Join.Sojourns.Mean() != 20 {
+		t.Log("Expected 10 parents released after 20 ticks with a sync delay of 10 but got", sys.Join.Released, sys.Join.Sojourns.Mean(), sys.Join.SyncDelays.Mean())
+		t.Fail()
+	}
+	for _, j := range sys.Released {
+		if j.SystemTime() != 20 {
+			t.Log("Parent should've been released 20 ticks after it arrived but took", j.SystemTime())
+			t.Fail()
+		}
+	}
+	if len(sys.Released) != 10 || len(sys.Join.waiting) != 1 {
+		t.Log("Stragglers should be forgotten once they arrive, but", len(sys.Join.waiting), "parents are still around")
+		t.Fail()
+	}
+}
+
+// Tests sending the released parent on to another station.
+func TestJoinThen(t *testing.T) {
+	t.Parallel()
+	var sys *funcSystem
+	var r *Router
+
+	sys = &funcSystem{InitFunc: func(sys *funcSystem) {
+		shardQ, shard := newStation(10)
+		finalQ, final := newStation(5)
+		sys.Procs = []*Processor{shard, final}
+		jn := NewJoin(sys.Sim, 0, Destination{Queue: finalQ}, 0)
+		jn.Processors = sys.Procs
+		sys.AP = NewConstantArrProc(100)
+		f := NewFork(sys.Sim, []Destination{{Queue: shardQ}, {Queue: shardQ}}, sys.AP)
+		f.Processors = sys.Procs
+		sys.AB = f
+		r = NewRouter(sys.Sim, sys.Procs, FixedRouting{shard: {ArrBeh: jn}}, 0)
+	}}
+	RunSimulation(sys, 1000, WithSeed(1))
+
+	// Each parent waits 20 ticks for its two children to get through the
+	// shard one after the other, then takes 5 ticks at the final station.
+	if r.Departed != 10 || r.Sojourns.Min() != 25 || r.Sojourns.Max() != 25 || r.Visits.Mean() != 2 {
+		t.Log("Expected 10 parents to depart after 25 ticks and 2 visits, but got", r.Departed, "after", r.Sojourns.Max(), "and", r.Visits.Mean())
+		t.Fail()
+	}
+}
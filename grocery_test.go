@@ -2,9 +2,7 @@ package qsim
 
 import (
 	"math"
-	"math/rand"
 	"testing"
-	"time"
 )
 
 // To run a simulation, you have to implement the System interface:
@@ -19,21 +17,28 @@ type GrocerySystem struct {
 	// The system's arrival behavior
 	arrBeh ArrBeh
 
-	SumCustomers int
-	SumTotalTime int
-	// Holds the list of Jobs that have finished since the last tick. We
-	// use this to keep track of the total time spent by customers in the
-	// system.
-	FinishedJobs    []*Job
+	SumCustomers    int
+	SumTotalTime    int
 	NumFinishedJobs int
 	prevClock       int
+
+	// Stats about the queues and processors, collected alongside the sums
+	// above so that they can be checked against each other.
+	Stats *SystemStats
+
+	sim *Simulation
+}
+
+// SetSimulation is called before Init. We hold on to the Simulation so that
+// we can draw random numbers from its Rand.
+func (sys *GrocerySystem) SetSimulation(sim *Simulation) {
+	sys.sim = sim
 }
 
 // Init runs before the simulation begins, and its job is to set up the
 // queues, processors, and behaviors.
 func (sys *GrocerySystem) Init() {
 	var i int
-	rand.Seed(time.Now().UnixNano())
 	// Customers arrive at the checkout line an average of every 30 seconds
 	// and the intervals between their arrivals are exponentially
 	// distributed.
@@ -41,7 +46,7 @@ func (sys *GrocerySystem) Init() {
 	// The time taken to check a customer out is normally distributed, with
 	// a mean of 60 seconds and a standard deviation of 10 seconds.
 	procTimeGenerator := func(j *Job) int {
-		return int(rand.NormFloat64()*10000.0 + 60000.0)
+		return int(sys.sim.Rand.NormFloat64()*10000.0 + 60000.0)
 	}
 	// There are 3 registers and 3 queues.
 	sys.queues = make([]*Queue, 3)
@@ -51,10 +56,15 @@ func (sys *GrocerySystem) Init() {
 		sys.queues[i].QueueId = i
 		sys.processors[i] = NewProcessor(procTimeGenerator)
 		sys.processors[i].ProcessorId = i
+		// Keep track of the average time Jobs spend in the system.
 		sys.processors[i].AfterFinish(func(p *Processor, j *Job) {
-			sys.FinishedJobs = append(sys.FinishedJobs, j)
+			sys.SumTotalTime += j.SojournTime()
+			sys.NumFinishedJobs++
 		})
 	}
+	// Keep track of queue lengths, utilization, and the time Jobs spend
+	// in the system.
+	sys.Stats = NewSystemStats(sys.sim, sys.queues, sys.processors, 0)
 	// When customers are ready to check out, they get in the shortest
 	// queue. Unless there's an empty register, in which case they go
 	// right ahead and start checking out.
@@ -121,20 +131,7 @@ func (sys *GrocerySystem) Processors() []*Processor {
 // AfterEvents runs at every tick when a simulation event happens, but
 // in contrast with BeforeEvents, it runs after all the events for that
 // tick have occurred.
-//
-// In this example we used it to keep track of the average time Jobs
-// spend in the system (by calculating total Job-ticks and the number
-// of Jobs finished).
-func (sys *GrocerySystem) AfterEvents(clock int) {
-	var j *Job
-	if len(sys.FinishedJobs) != 0 {
-		for _, j = range sys.FinishedJobs {
-			sys.SumTotalTime += clock - j.ArrTime
-			sys.NumFinishedJobs++
-		}
-		sys.FinishedJobs = sys.FinishedJobs[:0]
-	}
-}
+func (sys *GrocerySystem) AfterEvents(clock int) {}
 
 // Simulates a small grocery store checkout line:
 //
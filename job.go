@@ -19,19 +19,243 @@ type Job struct {
 	// this feature for testing, or for debugging, or for changing the behavior
 	// of the system for particular types of jobs.
 	StrAttrs map[string]string
+	// Priority determines the order in which Jobs are served by a Queue
+	// created with NewPriorityQueue: Jobs with higher Priority go first.
+	// The default is 0.
+	Priority int
+	// Class is a user-defined category for the Job, like "expedited" or
+	// "standard". Stats collectors break their results down by Class.
+	Class string
+	// ServiceEstimate is how long the Job is expected to take to process,
+	// for use by the ShortestProcessingTime Ordering. It's up to you to set
+	// it; the default is 0.
+	ServiceEstimate int
+	// Deadline is the tick by which the Job ought to be finished, for use by
+	// the EarliestDeadlineFirst Ordering. The default, -1, means the Job has
+	// no deadline.
+	Deadline int
+
+	// The fields below record the Job's progress through the system. They
+	// are filled in by Queue.Append, Processor.Start and Processor.Finish
+	// when the Job is part of a running Simulation; times that haven't
+	// happened (or can't be known) are -1.
+
+	// EnqueueTime is the time at which the Job was appended to Queue.
+	EnqueueTime int
+	// Queue is the Queue the Job was appended to, or nil if it went
+	// straight to a Processor.
+	Queue *Queue
+	// StartTime is the time at which the Job started service. If the Job
+	// was preempted and started again later, this is the first start.
+	StartTime int
+	// Processor is the Processor that served the Job.
+	Processor *Processor
+	// ServiceTime is the processing time that was drawn for the Job when
+	// it started service.
+	ServiceTime int
+	// SetupTime is the time the Processor spent getting ready for the Job
+	// before serving it, because the Job's Class was different from that
+	// of the Job before it. It isn't included in ServiceTime. See
+	// Processor.Setup.
+	SetupTime int
+	// DepartTime is the time at which the Job finished service.
+	DepartTime int
+	// Preemptions is the number of times the Job has been evicted from a
+	// Processor by Processor.Preempt.
+	Preemptions int
+	// RemainingTime is the processing time the Job still needed when it
+	// was last preempted in PreemptResume mode, or -1 if there's nothing to
+	// resume.
+	RemainingTime int
+	// Visits is the Job's history in a network of stations connected by a
+	// Router: one Visit for each station the Job has finished at, in
+	// order. EnqueueTime, Queue, StartTime, Processor, ServiceTime,
+	// SetupTime, and DepartTime describe only the Job's latest visit.
+	Visits []Visit
+	// Parent is the Job this one was split off from by a Fork, if any, and
+	// Children are the Jobs a Fork split this one into.
+	Parent   *Job
+	Children []*Job
+
+	// The Simulation the Job belongs to, if any. We use it to find out the
+	// time.
+	sim *Simulation
+	// The number of ticks the Job has spent in Queues before its current
+	// stretch of service, and whether it's been queued since it was last
+	// started.
+	waited int
+	queued bool
+	// When the Job's current stretch of service began and how long it was
+	// going to take, so that we can tell how much is left if it's
+	// preempted. resume is set when the next Processor to start the Job
+	// should use RemainingTime instead of drawing a processing time.
+	segStart, segTime int
+	resume            bool
+	// The time at which the Job arrived at its current station, if it's
+	// been forwarded by a Router.
+	stationArrTime int
+}
+
+// A Visit records a Job's stay at one station of a queueing network.
+type Visit struct {
+	// The Queue the Job waited in (nil if it went straight to a
+	// Processor) and the Processor that served it.
+	Queue     *Queue
+	Processor *Processor
+	// ArrTime is the time at which the Job arrived at the station.
+	ArrTime     int
+	EnqueueTime int
+	StartTime   int
+	ServiceTime int
+	SetupTime   int
+	DepartTime  int
+	// WaitTime is the number of ticks the Job spent in the station's
+	// Queue.
+	WaitTime int
+}
+
+// WaitTime returns the number of ticks the Job spent waiting in a Queue
+// before it started service. Jobs that went straight to a Processor have a
+// WaitTime of 0. If the Job hasn't started service yet, WaitTime returns -1.
+//
+// A Job that has been preempted and put back in a Queue waits again; all of
+// its time in Queues up to its most recent start is counted.
+func (j *Job) WaitTime() int {
+	if j.StartTime == -1 {
+		return -1
+	}
+	if j.Queue == nil {
+		return 0
+	}
+	if j.EnqueueTime == -1 {
+		return -1
+	}
+	return j.waited
+}
+
+// SojournTime returns the number of ticks between the Job's arrival and its
+// departure, or -1 if it hasn't departed yet.
+//
+// If the Job has been forwarded from one station to another by a Router,
+// SojournTime covers only the Job's latest visit: from its arrival at the
+// station to its departure from it. Use SystemTime for the whole trip.
+func (j *Job) SojournTime() int {
+	if j.DepartTime == -1 {
+		return -1
+	}
+	if len(j.Visits) > 0 {
+		return j.DepartTime - j.stationArrTime
+	}
+	return j.DepartTime - j.ArrTime
+}
+
+// SystemTime returns the number of ticks between the Job's arrival in the
+// system and its most recent departure from a Processor, or -1 if it
+// hasn't departed from one yet. Unless the Job has been forwarded by a
+// Router, this is the same as SojournTime.
+func (j *Job) SystemTime() int {
+	if j.DepartTime == -1 {
+		return -1
+	}
+	return j.DepartTime - j.ArrTime
+}
+
+// visit returns a record of the Job's current visit.
+func (j *Job) visit() Visit {
+	var v Visit
+	v = Visit{
+		Queue:       j.Queue,
+		Processor:   j.Processor,
+		ArrTime:     j.ArrTime,
+		EnqueueTime: j.EnqueueTime,
+		StartTime:   j.StartTime,
+		ServiceTime: j.ServiceTime,
+		SetupTime:   j.SetupTime,
+		DepartTime:  j.DepartTime,
+		WaitTime:    j.WaitTime(),
+	}
+	if len(j.Visits) > 0 {
+		v.ArrTime = j.stationArrTime
+	}
+	return v
+}
+
+// interrupt stops the Job's service partway through. If resume is true,
+// the work that's left is saved in RemainingTime so that the next Processor
+// to start the Job picks up where it left off; otherwise the work done so
+// far is thrown away.
+func (j *Job) interrupt(resume bool) {
+	var now int
+	j.resume = resume
+	j.RemainingTime = -1
+	if resume {
+		j.RemainingTime = j.segTime
+		if now = j.now(); now != -1 && j.segStart != -1 {
+			j.RemainingTime -= now - j.segStart
+		}
+	}
+}
+
+// forward records the Job's current visit and gets it ready to arrive at
+// another station.
+func (j *Job) forward() {
+	j.Visits = append(j.Visits, j.visit())
+	j.reset()
+}
+
+// reset clears the Job's lifecycle fields so that it can arrive at a
+// station as of the current time.
+func (j *Job) reset() {
+	j.stationArrTime = j.now()
+	j.EnqueueTime = -1
+	j.Queue = nil
+	j.StartTime = -1
+	j.Processor = nil
+	j.ServiceTime = -1
+	j.SetupTime = 0
+	j.DepartTime = -1
+	j.RemainingTime = -1
+	j.waited = 0
+	j.queued = false
+	j.resume = false
+}
+
+// now returns the current time in the Job's Simulation, or -1 if the Job
+// isn't part of a Simulation.
+func (j *Job) now() int {
+	if j.sim == nil {
+		return -1
+	}
+	return j.sim.clock
 }
 
 // NewJob creates a new... wait for it... Job.
 //
 // arrTime should be the simulation clock time at which the Job arrived.
 //
-// The Job will have a random nonnegative integer assigned to JobId. The caller
-// is expected to seed the PRNG if necessary..
+// The Job will have a random nonnegative integer assigned to JobId, drawn
+// from the global PRNG. Inside a simulation you should generally use
+// Simulation.NewJob instead, so that runs are reproducible and the Job's
+// timestamps get recorded.
 func NewJob(arrTime int) (j *Job) {
+	return newJob(arrTime, nil, nil)
+}
+
+// newJob creates a Job whose JobId is drawn from r (or from the global PRNG
+// if r is nil). sim is the Simulation the Job is part of, if any.
+func newJob(arrTime int, r *rand.Rand, sim *Simulation) (j *Job) {
 	j = new(Job)
 	j.IntAttrs = make(map[string]int)
 	j.StrAttrs = make(map[string]string)
-	j.JobId = rand.Int63()
+	j.JobId = randInt63(r)
 	j.ArrTime = arrTime
+	j.stationArrTime = arrTime
+	j.EnqueueTime = -1
+	j.StartTime = -1
+	j.ServiceTime = -1
+	j.DepartTime = -1
+	j.RemainingTime = -1
+	j.Deadline = -1
+	j.sim = sim
 	return j
 }
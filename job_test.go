@@ -30,3 +30,85 @@ func TestJobId(t *testing.T) {
 		jobs[j.JobId] = j
 	}
 }
+
+// Tests that a Job's lifecycle timestamps get filled in as it passes through
+// a Queue and a Processor.
+func TestJobLifecycle(t *testing.T) {
+	t.Parallel()
+	var sim *Simulation
+	var q *Queue
+	var p *Processor
+	var j *Job
+
+	sim = NewSimulation(&GrocerySystem{}, WithSeed(1))
+	q = NewQueue()
+	p = NewProcessor(simplePtg)
+	p.bindSimulation(sim)
+
+	sim.clock = 100
+	j = sim.NewJob()
+	if j.EnqueueTime != -1 || j.StartTime != -1 || j.DepartTime != -1 || j.ServiceTime != -1 {
+		t.Log("New Job should have unknown timestamps, but got", j.EnqueueTime, j.StartTime, j.ServiceTime, j.DepartTime)
+		t.Fail()
+	}
+	if j.WaitTime() != -1 || j.SojournTime() != -1 {
+		t.Log("New Job should have unknown WaitTime and SojournTime")
+		t.Fail()
+	}
+
+	sim.clock = 150
+	q.Append(j)
+	if j.Queue != q || j.EnqueueTime != 150 {
+		t.Log("Expected Job to be enqueued on", q, "at 150 but got", j.Queue, "at", j.EnqueueTime)
+		t.Fail()
+	}
+
+	sim.clock = 400
+	q.Shift()
+	p.Start(j)
+	if j.Processor != p || j.StartTime != 400 || j.ServiceTime != 293 {
+		t.Log("Expected Job to start on", p, "at 400 for 293 ticks but got", j.Processor, "at", j.StartTime, "for", j.ServiceTime)
+		t.Fail()
+	}
+	if j.WaitTime() != 250 {
+		t.Log("Expected WaitTime of 250 but got", j.WaitTime())
+		t.Fail()
+	}
+
+	sim.clock = 693
+	p.Finish()
+	if j.DepartTime != 693 {
+		t.Log("Expected DepartTime of 693 but got", j.DepartTime)
+		t.Fail()
+	}
+	if j.SojournTime() != 593 {
+		t.Log("Expected SojournTime of 593 but got", j.SojournTime())
+		t.Fail()
+	}
+}
+
+// Tests that a Job that goes straight to a Processor has no wait time, and
+// that Jobs outside of a Simulation don't get timestamps.
+func TestJobLifecycleNoQueue(t *testing.T) {
+	t.Parallel()
+	var p *Processor
+	var j *Job
+
+	p = NewProcessor(simplePtg)
+	j = NewJob(0)
+	p.Start(j)
+	if j.Processor != p || j.ServiceTime != 293 {
+		t.Log("Expected Job to start on", p, "for 293 ticks but got", j.Processor, "for", j.ServiceTime)
+		t.Fail()
+	}
+	if j.StartTime != -1 || j.WaitTime() != -1 {
+		t.Log("Job outside a Simulation should have unknown StartTime, but got", j.StartTime)
+		t.Fail()
+	}
+
+	j.StartTime = 10
+	if j.WaitTime() != 0 {
+		t.Log("Job that skipped the Queue should have WaitTime 0 but got", j.WaitTime())
+		t.Fail()
+	}
+}
@@ -0,0 +1,81 @@
+package qsim
+
+import (
+	"math/rand"
+)
+
+// An Ordering decides which Job a Queue serves next. Set a Queue's Ordering
+// field to change the order in which Shift takes Jobs out of it.
+type Ordering interface {
+	// Pick returns the index in q.Jobs of the Job that should be shifted
+	// next. Pick is only called when q has at least one Job.
+	Pick(q *Queue) int
+}
+
+// OrderingFunc lets an ordinary function serve as an Ordering.
+type OrderingFunc func(q *Queue) int
+
+// Pick calls f(q).
+func (f OrderingFunc) Pick(q *Queue) int {
+	return f(q)
+}
+
+// OrderBy returns an Ordering that serves Jobs in the order given by less:
+// the next Job shifted is one that no other Job in the Queue is less than.
+// Ties go to the Job that was appended first.
+//
+// Each call to Shift looks at every Job in the Queue.
+func OrderBy(less func(a, b *Job) bool) Ordering {
+	return OrderingFunc(func(q *Queue) int {
+		var i, best int
+		for i = 1; i < len(q.Jobs); i++ {
+			if less(q.Jobs[i], q.Jobs[best]) {
+				best = i
+			}
+		}
+		return best
+	})
+}
+
+// The built-in Orderings.
+var (
+	// FIFO serves Jobs first-in first-out. This is what a Queue does when
+	// it has no Ordering.
+	FIFO Ordering = OrderingFunc(func(q *Queue) int { return 0 })
+	// LIFO serves Jobs last-in first-out.
+	LIFO Ordering = OrderingFunc(func(q *Queue) int { return len(q.Jobs) - 1 })
+	// HighestPriorityFirst serves the Job with the highest Priority.
+	HighestPriorityFirst = OrderBy(func(a, b *Job) bool {
+		return a.Priority > b.Priority
+	})
+	// ShortestProcessingTime serves the Job with the smallest
+	// ServiceEstimate.
+	ShortestProcessingTime = OrderBy(func(a, b *Job) bool {
+		return a.ServiceEstimate < b.ServiceEstimate
+	})
+	// EarliestDeadlineFirst serves the Job with the earliest Deadline. Jobs
+	// without a Deadline are served after all the Jobs that have one.
+	EarliestDeadlineFirst = OrderBy(func(a, b *Job) bool {
+		if a.Deadline == -1 || b.Deadline == -1 {
+			return b.Deadline == -1 && a.Deadline != -1
+		}
+		return a.Deadline < b.Deadline
+	})
+)
+
+// SIRO ("service in random order") serves a Job chosen at random.
+type SIRO struct {
+	// Rand is used to pick Jobs. If Rand is nil, SIRO draws from the Rand
+	// of the Simulation that the Jobs belong to.
+	Rand *rand.Rand
+}
+
+// Pick returns the index of a random Job.
+func (o *SIRO) Pick(q *Queue) int {
+	var r *rand.Rand
+	r = o.Rand
+	if r == nil && q.Jobs[0].sim != nil {
+		r = q.Jobs[0].sim.Rand
+	}
+	return randIntn(r, len(q.Jobs))
+}
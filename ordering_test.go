@@ -0,0 +1,141 @@
+package qsim
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// shiftOrder appends Jobs to a Queue with the given Ordering, shifts them all
+// out, and returns the order in which they came out as indices into jobs.
+func shiftOrder(o Ordering, jobs []*Job) (order []int) {
+	var q *Queue
+	var j *Job
+	var i int
+
+	q = NewQueue()
+	q.Ordering = o
+	for i, j = range jobs {
+		j.IntAttrs["i"] = i
+		q.Append(j)
+	}
+	for q.Length() > 0 {
+		j, _ = q.Shift()
+		order = append(order, j.IntAttrs["i"])
+	}
+	return order
+}
+
+// Tests the built-in deterministic Orderings.
+func TestOrderings(t *testing.T) {
+	t.Parallel()
+	var jobs []*Job
+	var i int
+
+	newJobs := func() []*Job {
+		jobs = make([]*Job, 5)
+		for i = range jobs {
+			jobs[i] = NewJob(0)
+		}
+		return jobs
+	}
+	check := func(name string, got, exp []int) {
+		if len(got) != len(exp) {
+			t.Log(name, "shifted", got, "but expected", exp)
+			t.Fail()
+			return
+		}
+		for i = range exp {
+			if got[i] != exp[i] {
+				t.Log(name, "shifted", got, "but expected", exp)
+				t.Fail()
+				return
+			}
+		}
+	}
+
+	check("FIFO", shiftOrder(FIFO, newJobs()), []int{0, 1, 2, 3, 4})
+	check("nil", shiftOrder(nil, newJobs()), []int{0, 1, 2, 3, 4})
+	check("LIFO", shiftOrder(LIFO, newJobs()), []int{4, 3, 2, 1, 0})
+
+	jobs = newJobs()
+	for i, est := range []int{30, 10, 20, 10, 5} {
+		jobs[i].ServiceEstimate = est
+	}
+	check("ShortestProcessingTime", shiftOrder(ShortestProcessingTime, jobs), []int{4, 1, 3, 2, 0})
+
+	jobs = newJobs()
+	for i, dl := range []int{-1, 50, 20, -1, 20} {
+		jobs[i].Deadline = dl
+	}
+	check("EarliestDeadlineFirst", shiftOrder(EarliestDeadlineFirst, jobs), []int{2, 4, 1, 0, 3})
+
+	jobs = newJobs()
+	for i, pri := range []int{0, 3, 1, 3, 0} {
+		jobs[i].Priority = pri
+	}
+	check("HighestPriorityFirst", shiftOrder(HighestPriorityFirst, jobs), []int{1, 3, 2, 0, 4})
+}
+
+// Tests that SIRO serves every Job exactly once, in an order that depends
+// on its Rand.
+func TestSIRO(t *testing.T) {
+	t.Parallel()
+	var order0, order1 []int
+	var seen map[int]bool
+	var i int
+
+	newJobs := func() (jobs []*Job) {
+		for i = 0; i < 20; i++ {
+			jobs = append(jobs, NewJob(0))
+		}
+		return jobs
+	}
+	order0 = shiftOrder(&SIRO{Rand: rand.New(rand.NewSource(1))}, newJobs())
+	order1 = shiftOrder(&SIRO{Rand: rand.New(rand.NewSource(1))}, newJobs())
+
+	seen = make(map[int]bool)
+	for i = range order0 {
+		seen[order0[i]] = true
+		if order0[i] != order1[i] {
+			t.Log("SIRO with the same seed shifted Jobs in different orders")
+			t.Fail()
+			break
+		}
+	}
+	if len(seen) != 20 {
+		t.Log("SIRO didn't shift every Job exactly once:", order0)
+		t.Fail()
+	}
+	for i = range order0 {
+		if order0[i] != i {
+			return
+		}
+	}
+	t.Log("SIRO shifted Jobs in FIFO order")
+	t.Fail()
+}
+
+// Tests that the Shift callbacks still see the Job that the Ordering picked.
+func TestOrderingShiftCallbacks(t *testing.T) {
+	t.Parallel()
+	var q *Queue
+	var j0, j1, before, after *Job
+
+	q = NewQueue()
+	q.Ordering = LIFO
+	j0, j1 = NewJob(0), NewJob(0)
+	q.Append(j0)
+	q.Append(j1)
+	q.BeforeShift(func(q *Queue, j *Job) { before = j })
+	q.AfterShift(func(q *Queue, j *Job) { after = j })
+
+	q.Shift()
+	if before != j1 || after != j1 {
+		t.Log("Shift callbacks should've been passed the last Job appended")
+		t.Fail()
+	}
+	if q.Length() != 1 || q.Jobs[0] != j0 {
+		t.Log("Wrong Job left in the Queue after a LIFO Shift")
+		t.Fail()
+	}
+}
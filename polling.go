@@ -0,0 +1,219 @@
+package qsim
+
+// A PollingMode says how long the server in a PollingDiscipline stays at
+// each Queue it visits.
+type PollingMode int
+
+const (
+	// PollExhaustive serves the Queue until it's empty, including any Jobs
+	// that arrive during the visit.
+	PollExhaustive PollingMode = iota
+	// PollGated serves only the Jobs that were already in the Queue when
+	// the server got there. Jobs that arrive during the visit wait for the
+	// next one.
+	PollGated
+	// PollLimited serves at most Limit Jobs per visit.
+	PollLimited
+)
+
+// PollingDiscipline has a single Processor visit a number of Queues in turn,
+// like an engineer who works through several ticket queues one after the
+// other. Create one with NewPollingDiscipline.
+//
+// The server stays at each Queue for as long as its Mode allows, and then
+// moves on to the next one, wrapping around after the last. Moving from
+// one Queue to the next takes the number of ticks given by Switchover;
+// while the server is switching, Next returns nil, even though the
+// Processor looks idle. Once it gets to the next Queue, the Processor is
+// asked to Pull. If the server makes its way around every Queue without
+// finding anything to do, it keeps going around as long as switching takes
+// time, and otherwise it waits where it is until a Job shows up.
+//
+// Since the Processor may look idle while it's switching, the Jobs should
+// be put in the Queues by an arrival behavior that never starts them on a
+// Processor directly, such as AlwaysQueueArrBeh. The Processor's Capacity
+// should be 1.
+type PollingDiscipline struct {
+	Queues    []*Queue
+	Processor *Processor
+	// Mode says how long the server stays at each Queue. The default is
+	// PollExhaustive.
+	Mode PollingMode
+	// Limit is the most Jobs the server will take from a Queue per visit
+	// when Mode is PollLimited.
+	Limit int
+	// Switchover returns the number of ticks it takes the server to get
+	// from one Queue to the next. If Switchover is nil, switching takes no
+	// time.
+	Switchover func(from, to *Queue) int
+	// Cycles is the number of times the server has made its way around
+	// all the Queues.
+	Cycles int
+
+	sim *Simulation
+	// The index of the Queue the server is at, or is headed to.
+	cur int
+	// Whether the server is on its way to the next Queue.
+	switching bool
+	// The number of Jobs the server has started during the current visit,
+	// and the number it may still start under PollGated.
+	served int
+	gate   int
+	// Callback lists
+	cbBeforeSwitch []func(d *PollingDiscipline, from, to *Queue)
+	cbAfterSwitch  []func(d *PollingDiscipline, from, to *Queue)
+}
+
+// Next shifts the next Job out of the Queue the server is visiting. If the
+// visit is over, the server moves on, and Next returns the first Job from
+// the next Queue that has one, or nil if the server has to spend time
+// switching.
+func (d *PollingDiscipline) Next(p *Processor) *Job {
+	var q *Queue
+	var j *Job
+	var i int
+	if d.switching || len(d.Queues) == 0 {
+		return nil
+	}
+	// Go around at most once, so that we don't spin forever when every
+	// Queue is empty and switching takes no time.
+	for i = 0; i <= len(d.Queues); i++ {
+		q = d.Queues[d.cur]
+		if d.mayServe(q) {
+			j, _ = q.Shift()
+			d.served++
+			d.gate--
+			D("Processor", p.ProcessorId, "is polling Queue", q.QueueId, "and began Job", j.JobId)
+			return j
+		}
+		if i == len(d.Queues) || !d.switchToNext() {
+			break
+		}
+	}
+	return nil
+}
+
+// mayServe returns true if the server should take another Job from q
+// during the current visit.
+func (d *PollingDiscipline) mayServe(q *Queue) bool {
+	if q.Length() == 0 {
+		return false
+	}
+	switch d.Mode {
+	case PollGated:
+		return d.gate > 0
+	case PollLimited:
+		return d.served < d.Limit
+	}
+	return true
+}
+
+// switchToNext sends the server on to the next Queue. It returns true if
+// the server got there right away, or false if it has to spend time
+// switching first.
+func (d *PollingDiscipline) switchToNext() bool {
+	var from, to *Queue
+	var next, t int
+	next = (d.cur + 1) % len(d.Queues)
+	from, to = d.Queues[d.cur], d.Queues[next]
+	d.beforeSwitch(from, to)
+	if d.Switchover != nil {
+		t = d.Switchover(from, to)
+	}
+	if t <= 0 {
+		d.arrive(next)
+		d.afterSwitch(from, to)
+		return true
+	}
+	d.switching = true
+	D("Server is switching from Queue", from.QueueId, "to Queue", to.QueueId)
+	d.sim.ScheduleAfter(t, func(clock int) {
+		d.switching = false
+		d.arrive(next)
+		d.afterSwitch(from, to)
+		if d.Processor != nil {
+			d.Processor.Pull()
+		}
+	})
+	return false
+}
+
+// arrive starts the server's visit to the Queue at index i.
+func (d *PollingDiscipline) arrive(i int) {
+	if i == 0 {
+		d.Cycles++
+	}
+	d.cur = i
+	d.served = 0
+	d.gate = d.Queues[i].Length()
+}
+
+// Current returns the Queue the server is visiting, or is on its way to.
+func (d *PollingDiscipline) Current() *Queue {
+	return d.Queues[d.cur]
+}
+
+// IsSwitching returns true if the server is on its way from one Queue to
+// the next.
+func (d *PollingDiscipline) IsSwitching() bool {
+	return d.switching
+}
+
+// Attach makes p the server.
+func (d *PollingDiscipline) Attach(p *Processor) {
+	d.Processor = p
+}
+
+// Detach takes p away, if it's the server.
+func (d *PollingDiscipline) Detach(p *Processor) {
+	if d.Processor == p {
+		d.Processor = nil
+	}
+}
+
+// BeforeSwitch adds a callback to be run immediately before the server
+// leaves a Queue for the next one.
+//
+// The callback will be passed the PollingDiscipline itself, the Queue the
+// server is leaving, and the Queue it's headed to.
+func (d *PollingDiscipline) BeforeSwitch(f func(d *PollingDiscipline, from, to *Queue)) {
+	d.cbBeforeSwitch = append(d.cbBeforeSwitch, f)
+}
+func (d *PollingDiscipline) beforeSwitch(from, to *Queue) {
+	for _, cb := range d.cbBeforeSwitch {
+		cb(d, from, to)
+	}
+}
+
+// AfterSwitch adds a callback to be run immediately after the server gets
+// to the next Queue, once the switchover time has elapsed.
+//
+// The callback will be passed the PollingDiscipline itself, the Queue the
+// server left, and the Queue it's now visiting. The server hasn't started
+// any Jobs from the new Queue yet.
+func (d *PollingDiscipline) AfterSwitch(f func(d *PollingDiscipline, from, to *Queue)) {
+	d.cbAfterSwitch = append(d.cbAfterSwitch, f)
+}
+func (d *PollingDiscipline) afterSwitch(from, to *Queue) {
+	for _, cb := range d.cbAfterSwitch {
+		cb(d, from, to)
+	}
+}
+
+func (d *PollingDiscipline) bindSimulation(sim *Simulation) {
+	d.sim = sim
+}
+
+// NewPollingDiscipline generates a PollingDiscipline in which p visits
+// queues in order, staying at each one as long as mode allows. The server
+// starts out at the first Queue.
+func NewPollingDiscipline(queues []*Queue, p *Processor, mode PollingMode) *PollingDiscipline {
+	var d *PollingDiscipline
+
+	d = &PollingDiscipline{Queues: queues, Mode: mode}
+	if len(queues) > 0 {
+		d.gate = queues[0].Length()
+	}
+	p.SetDiscipline(d)
+	return d
+}
@@ -0,0 +1,121 @@
+package qsim
+
+import (
+	"testing"
+)
+
+// Tests the order in which a PollingDiscipline serves its Queues under each
+// PollingMode, when switching takes no time.
+func TestPollingDiscipline(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		mode  PollingMode
+		order []int
+	}{
+		{PollExhaustive, []int{0, 0, 0, 1, 2, 2, 2}},
+		{PollGated, []int{0, 0, 1, 2, 2, 2, 0}},
+		{PollLimited, []int{0, 1, 2, 0, 2, 0, 2}},
+	}
+
+	for _, test := range tests {
+		var queues []*Queue
+		var p *Processor
+		var d *PollingDiscipline
+		var order []int
+		var i, n int
+
+		for i = 0; i < 3; i++ {
+			queues = append(queues, NewQueue())
+			queues[i].QueueId = i
+		}
+		for i, n = range []int{2, 1, 3} {
+			for ; n > 0; n-- {
+				queues[i].Append(NewJob(0))
+			}
+		}
+		p = NewProcessor(simplePtg)
+		p.BeforeStart(func(p *Processor, j *Job) {
+			order = append(order, j.Queue.QueueId)
+			// Another Job shows up at the first Queue while the server is
+			// there.
+			if len(order) == 1 {
+				queues[0].Append(NewJob(0))
+			}
+		})
+		d = NewPollingDiscipline(queues, p, test.mode)
+		d.Limit = 1
+
+		p.Pull()
+		for i = 0; i < 7; i++ {
+			p.Finish()
+		}
+		if len(order) != len(test.order) {
+			t.Log("Expected Jobs to be served from Queues", test.order, "but got", order)
+			t.Fail()
+			continue
+		}
+		for i = range order {
+			if order[i] != test.order[i] {
+				t.Log("Expected Jobs to be served from Queues", test.order, "but got", order)
+				t.Fail()
+				break
+			}
+		}
+	}
+}
+
+// Tests that the server doesn't start any Jobs while it's switching between
+// Queues, and that switching takes as long as Switchover says.
+func TestPollingDisciplineSwitchover(t *testing.T) {
+	t.Parallel()
+	var sys *funcSystem
+	var d *PollingDiscipline
+	var ps *ProcessorStats
+	var switchedAt int
+	var startedWhileSwitching, wrongSwitchover bool
+
+	sys = &funcSystem{InitFunc: func(sys *funcSystem) {
+		var queues []*Queue
+		var p *Processor
+		var aqab *AlwaysQueueArrBeh
+		var n int
+		queues = []*Queue{NewQueue(), NewQueue()}
+		p = NewProcessor(func(j *Job) int { return 5 })
+		sys.Procs = []*Processor{p}
+		sys.AP = NewConstantArrProc(20)
+		aqab = NewAlwaysQueueArrBeh(queues[0], sys.AP).(*AlwaysQueueArrBeh)
+		aqab.Processors = sys.Procs
+		aqab.BeforeAssign(func(ab ArrBeh, j *Job) *Assignment {
+			n++
+			return &Assignment{Type: "Queue", Queue: queues[n%2]}
+		})
+		sys.AB = aqab
+
+		d = NewPollingDiscipline(queues, p, PollExhaustive)
+		d.Switchover = func(from, to *Queue) int { return 10 }
+		d.BeforeSwitch(func(d *PollingDiscipline, from, to *Queue) {
+			switchedAt = sys.Sim.Clock()
+		})
+		d.AfterSwitch(func(d *PollingDiscipline, from, to *Queue) {
+			if sys.Sim.Clock()-switchedAt != 10 {
+				wrongSwitchover = true
+			}
+		})
+		p.BeforeStart(func(p *Processor, j *Job) {
+			if d.IsSwitching() || j.Queue != d.Current() {
+				startedWhileSwitching = true
+			}
+		})
+		ps = NewProcessorStats(sys.Sim, p, 0)
+	}}
+	RunSimulation(sys, 10000, WithSeed(1))
+
+	if startedWhileSwitching || wrongSwitchover {
+		t.Log("Expected the server to serve only the Queue it's at, and to take 10 ticks to switch")
+		t.Fail()
+	}
+	if ps.Completed < 495 || d.Cycles < 250 {
+		t.Log("Expected about 500 Jobs to finish and at least 250 cycles but got", ps.Completed, "and", d.Cycles)
+		t.Fail()
+	}
+}
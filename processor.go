@@ -5,24 +5,125 @@ import (
 )
 
 // A Processor is the piece of the queueing system that processes jobs.
+//
+// By default a Processor works on one Job at a time, but it can be given a
+// Capacity greater than 1 to model several identical servers (the agents in
+// a call center, say) that work on Jobs independently.
 type Processor struct {
 	// The current job being processed. If the processor is idle, this
-	// will be nil.
+	// will be nil. If the Processor has a Capacity greater than 1, this is
+	// the Job that has been in service the longest.
 	CurrentJob *Job
+	// All the Jobs being processed, in the order in which they were
+	// started.
+	Jobs []*Job
+	// The number of Jobs the Processor can work on at once. NewProcessor
+	// sets this to 1. Capacity may be raised during the course of a
+	// simulation; if it's lowered, the Jobs in progress are allowed to
+	// finish. To change it in the middle of a simulation, use Resize, so
+	// that the Processor's ArrBeh and stats find out.
+	Capacity int
 	// A unique identifier for the Processor. Useful for debugging, as it
 	// will be printed in debug output for events involving the Processor.
 	// The implementor must set this value if it's going to be used –
 	// otherwise it will be 0 (and thus not unique)
 	ProcessorId int
+	// Preemption says what becomes of the work already done on a Job that
+	// Preempt evicts. The default is PreemptResume.
+	Preemption PreemptMode
+	// FailPolicy says what becomes of the Jobs in service when the
+	// Processor fails. The default is FailResume.
+	FailPolicy FailPolicy
+	// Setup, if it isn't nil, gives the time the Processor needs to get
+	// ready for a Job whose Class is different from that of the Job it
+	// started last: retooling a machine for another product, say. The
+	// setup time is added to the Job's processing time, but recorded
+	// separately in its SetupTime.
+	Setup Setup
 
 	procTimeGenerator func(j *Job) int
+	// The Discipline that tells us which Job to start next, if any.
+	discipline Discipline
+	// The Simulation we're part of, if any.
+	sim *Simulation
+	// Whether the Processor is down, and the Jobs whose service was
+	// interrupted when it failed, to be started again once it's repaired.
+	down bool
+	held []*Job
+	// Whether the Processor has been closed.
+	closed bool
+	// The Class of the Job started last.
+	lastClass string
 	// Callback lists
-	cbBeforeStart  []func(p *Processor, j *Job)
-	cbAfterStart   []func(p *Processor, j *Job, procTime int)
-	cbBeforeFinish []func(p *Processor, j *Job)
-	cbAfterFinish  []func(p *Processor, j *Job)
+	cbBeforeStart   []func(p *Processor, j *Job)
+	cbAfterStart    []func(p *Processor, j *Job, procTime int)
+	cbBeforeFinish  []func(p *Processor, j *Job)
+	cbAfterFinish   []func(p *Processor, j *Job)
+	cbBeforePreempt []func(p *Processor, newJob, evicted *Job)
+	cbAfterPreempt  []func(p *Processor, newJob, evicted *Job)
+	cbBeforeFail    []func(p *Processor)
+	cbAfterFail     []func(p *Processor, lost []*Job)
+	cbBeforeRepair  []func(p *Processor)
+	cbAfterRepair   []func(p *Processor)
+	cbBeforeClose   []func(p *Processor)
+	cbAfterClose    []func(p *Processor, evicted []*Job)
+	cbBeforeOpen    []func(p *Processor)
+	cbAfterOpen     []func(p *Processor)
+	cbBeforeResize  []func(p *Processor, capacity int)
+	cbAfterResize   []func(p *Processor, evicted []*Job)
+	cbBeforeSetup   []func(p *Processor, j *Job)
+	cbAfterSetup    []func(p *Processor, j *Job, setupTime int)
+	// Hooks that send a finished Job on its way once all the AfterFinish
+	// callbacks have seen it. See Router.
+	departHooks []func(p *Processor, j *Job)
+	// Hooks that call off the pending finish of a Job that's being evicted
+	// by Close or Resize. See Simulation.
+	evictHooks []func(p *Processor, j *Job)
 }
 
+// A PreemptMode says what becomes of the work a Processor has already done
+// on a Job when the Job is preempted.
+type PreemptMode int
+
+const (
+	// PreemptResume keeps track of how much work is left on the Job. When
+	// it's started again, it only needs the remaining processing time.
+	PreemptResume PreemptMode = iota
+	// PreemptRestart throws the work away. When the Job is started again,
+	// a fresh processing time is drawn for it.
+	PreemptRestart
+)
+
+// A FailPolicy says what becomes of the Jobs a Processor is working on when
+// it fails.
+type FailPolicy int
+
+const (
+	// FailResume keeps the Jobs on the Processor. Once it's repaired, they
+	// pick up where they left off.
+	FailResume FailPolicy = iota
+	// FailRestart keeps the Jobs on the Processor, but throws away the
+	// work done on them. Once it's repaired, they start over with fresh
+	// processing times.
+	FailRestart
+	// FailLose throws the Jobs away. They never finish.
+	FailLose
+)
+
+// A CloseMode says what becomes of the Jobs a Processor is working on when
+// it's closed, or when its Capacity is lowered below the number of Jobs in
+// service.
+type CloseMode int
+
+const (
+	// CloseGraceful lets the Jobs in service finish. The Processor just
+	// stops taking new ones.
+	CloseGraceful CloseMode = iota
+	// CloseHard evicts the Jobs in service right away, as though they'd
+	// been preempted.
+	CloseHard
+)
+
 // SetProcTimeGenerator sets the function that will generate processing
 // times for jobs.
 //
@@ -44,18 +145,65 @@ func (p *Processor) SetProcTimeGenerator(ptg func(j *Job) int) {
 // Start begins processing a given job.
 //
 // The return value is the amount of time it'll take to process the job.
-// This method will throw an error if called when there's already a job
-// being processed: that job needs to be finished first.
+// This method will throw an error if called when the Processor is already
+// working on as many Jobs as its Capacity allows: one of them needs to be
+// finished first.
+//
+// If the Processor has a Setup, the time it takes to get ready for the Job
+// is added to the processing time.
+//
+// If the Job was preempted in PreemptResume mode, it picks up where it left
+// off: the processing time is whatever was remaining, and no new one is
+// drawn. No new setup is needed either.
 func (p *Processor) Start(j *Job) (procTime int, err error) {
+	var now, setup int
+	var drewSetup bool
 	p.beforeStart(j)
-	if p.CurrentJob != nil {
+	if p.FreeSlots() == 0 {
 		p.afterStart(nil, 0)
 		return 0, errors.New("Tried to start job on busy processor; call Finish() first")
 	}
-	p.CurrentJob = j
-	procTime = p.procTimeGenerator(j)
+	if j != nil && j.resume {
+		procTime = j.RemainingTime
+	} else {
+		procTime = p.procTimeGenerator(j)
+		if j != nil && p.Setup != nil {
+			p.beforeSetup(j)
+			setup = p.Setup.SetupTime(p.lastClass, j.Class)
+			drewSetup = true
+		}
+	}
+	if j != nil {
+		p.Jobs = append(p.Jobs, j)
+		p.CurrentJob = p.Jobs[0]
+		if j.sim == nil {
+			j.sim = p.sim
+		}
+		now = j.now()
+		if j.queued && j.EnqueueTime != -1 && now != -1 {
+			j.waited += now - j.EnqueueTime
+		}
+		j.queued = false
+		if j.StartTime == -1 {
+			j.StartTime = now
+		}
+		j.Processor = p
+		if j.resume {
+			j.resume = false
+			j.RemainingTime = -1
+		} else {
+			j.ServiceTime = procTime
+			j.SetupTime = setup
+			procTime += setup
+		}
+		j.segStart, j.segTime = now, procTime
+		p.lastClass = j.Class
+	}
+	if drewSetup {
+		p.afterSetup(j, setup)
+	}
 	if procTime == 0 {
-		p.Finish()
+		p.FinishJob(j)
 	} else {
 		p.afterStart(j, procTime)
 	}
@@ -64,19 +212,380 @@ func (p *Processor) Start(j *Job) (procTime int, err error) {
 
 // Finish empties the current job out of the Processor and returns it.
 //
-// If Finish is called on an idle processor, j will be nil.
+// The Job's DepartTime is set to the current time. If Finish is called on an
+// idle processor, j will be nil.
 func (p *Processor) Finish() (j *Job) {
-	j = p.CurrentJob
+	return p.FinishJob(p.CurrentJob)
+}
+
+// FinishJob finishes a particular Job that the Processor is working on and
+// returns it. This is how Jobs get finished on a Processor whose Capacity
+// is greater than 1.
+//
+// The Job's DepartTime is set to the current time. If the Job isn't being
+// processed by p, the Finish callbacks still run, but with a nil Job, and
+// FinishJob returns nil.
+func (p *Processor) FinishJob(jToFinish *Job) (j *Job) {
+	var i int
+	var k *Job
+	for i, k = range p.Jobs {
+		if k == jToFinish {
+			j = k
+			break
+		}
+	}
+	if j != nil {
+		j.DepartTime = j.now()
+	}
 	p.beforeFinish(j)
-	p.CurrentJob = nil
+	if j != nil {
+		p.Jobs = append(p.Jobs[:i], p.Jobs[i+1:]...)
+		p.CurrentJob = nil
+		if len(p.Jobs) > 0 {
+			p.CurrentJob = p.Jobs[0]
+		}
+	}
 	p.afterFinish(j)
+	if j != nil {
+		for _, hook := range p.departHooks {
+			hook(p, j)
+		}
+	}
+	p.Pull()
 	return j
 }
 
+// Preempt starts newJob on the Processor, evicting one of the Jobs in
+// service to make room for it if necessary. It returns the evicted Job (or
+// nil, if the Processor had a free slot) along with the same values as
+// Start.
+//
+// The Job evicted is the one with the lowest Priority; if there's a tie,
+// it's the one that was started most recently. Its pending finish is
+// called off, and depending on the Processor's Preemption mode, the work
+// done on it so far is either kept track of in RemainingTime or thrown
+// away. The evicted Job is then put back at the head of q with Prepend. If
+// q is nil, the evicted Job is just returned, and it's up to the caller to
+// find it a new home.
+//
+// Preempt doesn't check whether newJob deserves to go ahead of the Job it
+// evicts; that's for the caller to decide. It does refuse to preempt a
+// Processor that's closed or down, or that's still over its Capacity after
+// a graceful shrink, since newJob couldn't be started there even with one
+// Job out of the way: in that case nothing is evicted and an error is
+// returned.
+func (p *Processor) Preempt(newJob *Job, q *Queue) (evicted *Job, procTime int, err error) {
+	var i, k int
+	if p.closed || p.down {
+		return nil, 0, errors.New("Tried to preempt a job on a processor that's closed or down")
+	}
+	if p.FreeSlots() > 0 || len(p.Jobs) == 0 {
+		procTime, err = p.Start(newJob)
+		return nil, procTime, err
+	}
+	if len(p.Jobs)-1 >= maxInt(p.Capacity, 1) {
+		return nil, 0, errors.New("Tried to preempt a job on a processor that's over capacity")
+	}
+
+	for k = range p.Jobs {
+		if p.Jobs[k].Priority <= p.Jobs[i].Priority {
+			i = k
+		}
+	}
+	evicted = p.Jobs[i]
+	p.beforePreempt(newJob, evicted)
+	p.Jobs = append(p.Jobs[:i], p.Jobs[i+1:]...)
+	p.CurrentJob = nil
+	if len(p.Jobs) > 0 {
+		p.CurrentJob = p.Jobs[0]
+	}
+
+	evicted.Preemptions++
+	evicted.interrupt(p.Preemption == PreemptResume)
+	if q != nil {
+		q.Prepend(evicted)
+	}
+
+	procTime, err = p.Start(newJob)
+	p.afterPreempt(newJob, evicted)
+	return evicted, procTime, err
+}
+
+// Fail takes the Processor out of service until Repair is called: a
+// register jams, or a build agent crashes. While the Processor is down, it
+// isn't idle and no Jobs can be started on it.
+//
+// What happens to the Jobs in service depends on the Processor's
+// FailPolicy. Their pending finishes are called off, and unless they're
+// lost, they're held until the Processor is repaired, and then started
+// again. If the Processor was closed or shrunk in the meantime, only as
+// many as it has room for are started; the rest stay held until it has
+// room again (see Pull). A hard Close or Resize evicts held Jobs just like
+// Jobs in service. Fail returns the Jobs that were lost, if any. Calling
+// Fail on a Processor that's already down does nothing.
+func (p *Processor) Fail() (lost []*Job) {
+	var j *Job
+	if p.down {
+		return nil
+	}
+	p.beforeFail()
+	p.down = true
+	for _, j = range p.Jobs {
+		if p.FailPolicy == FailLose {
+			lost = append(lost, j)
+			continue
+		}
+		j.interrupt(p.FailPolicy == FailResume)
+		p.held = append(p.held, j)
+	}
+	p.Jobs = nil
+	p.CurrentJob = nil
+	D("Processor", p.ProcessorId, "failed; lost", len(lost), "Jobs")
+	p.afterFail(lost)
+	return lost
+}
+
+// Repair puts a Processor that has failed back into service. The Jobs that
+// were interrupted by the failure are started again, as many as there's
+// room for, and then the Processor pulls more work from its Discipline if
+// it has room. Calling Repair on a Processor that isn't down does nothing.
+func (p *Processor) Repair() {
+	if !p.down {
+		return
+	}
+	p.beforeRepair()
+	p.down = false
+	p.resumeHeld()
+	D("Processor", p.ProcessorId, "was repaired")
+	p.afterRepair()
+	p.Pull()
+}
+
+// resumeHeld starts the Jobs held since the Processor failed, in the order
+// they were first started, until it runs out of room. It returns the number
+// of Jobs started.
+func (p *Processor) resumeHeld() (n int) {
+	var j *Job
+	var err error
+	for len(p.held) > 0 && p.FreeSlots() > 0 {
+		// Take the Job off the list first, since starting it runs callbacks
+		// that may call Pull.
+		j, p.held = p.held[0], p.held[1:]
+		if _, err = p.Start(j); err != nil {
+			D("Processor", p.ProcessorId, "couldn't restart a held Job:", err)
+			p.held = append([]*Job{j}, p.held...)
+			break
+		}
+		n++
+	}
+	if len(p.held) == 0 {
+		p.held = nil
+	}
+	return n
+}
+
+// IsDown returns true if the Processor has failed and hasn't been repaired
+// yet.
+func (p *Processor) IsDown() bool {
+	return p.down
+}
+
+// Close stops the Processor from taking new Jobs until Open is called: the
+// end of a support agent's shift, say. While the Processor is closed, it
+// isn't idle and no Jobs can be started on it.
+//
+// With CloseGraceful, the Jobs in service are allowed to finish. With
+// CloseHard, they're evicted: their pending finishes are called off, the
+// work done on them is kept track of or thrown away according to the
+// Processor's Preemption mode, and they're put back at the head of q with
+// Prepend, so that the one that was started first ends up at the very
+// front. If q is nil, it's up to the caller to find the evicted Jobs a new
+// home. Close returns the evicted Jobs, if any. Jobs held by a Processor
+// that's down (see Fail) are evicted along with the ones in service.
+//
+// Calling Close on a Processor that's already closed evicts whatever's
+// still in service or held if mode is CloseHard, and otherwise does
+// nothing.
+func (p *Processor) Close(mode CloseMode, q *Queue) (evicted []*Job) {
+	if p.closed && (mode == CloseGraceful || len(p.Jobs)+len(p.held) == 0) {
+		return nil
+	}
+	p.beforeClose()
+	p.closed = true
+	if mode == CloseHard {
+		evicted = p.evict(len(p.Jobs)+len(p.held), q)
+	}
+	D("Processor", p.ProcessorId, "closed; evicted", len(evicted), "Jobs")
+	p.afterClose(evicted)
+	return evicted
+}
+
+// Open puts a Processor that has been closed back into service, and then
+// the Processor pulls work from its Discipline if it has room. Calling Open
+// on a Processor that isn't closed does nothing.
+func (p *Processor) Open() {
+	if !p.closed {
+		return
+	}
+	p.beforeOpen()
+	p.closed = false
+	D("Processor", p.ProcessorId, "opened")
+	p.afterOpen()
+	p.Pull()
+}
+
+// IsClosed returns true if the Processor has been closed and hasn't been
+// opened again yet.
+func (p *Processor) IsClosed() bool {
+	return p.closed
+}
+
+// Resize changes the Processor's Capacity: more agents come on duty, or
+// some of them go home. If the Capacity goes up, the Processor pulls work
+// from its Discipline to fill the new slots.
+//
+// If the Capacity goes down below the number of Jobs in service, mode says
+// what becomes of the extra Jobs. With CloseGraceful, they're allowed to
+// finish, and no new Jobs are started until the Processor is back under
+// its Capacity. With CloseHard, the Jobs that were started most recently
+// are evicted, just as Close would evict them. Jobs held by a Processor
+// that's down count as in service here. Resize returns the evicted Jobs, if
+// any.
+func (p *Processor) Resize(capacity int, mode CloseMode, q *Queue) (evicted []*Job) {
+	var n int
+	p.beforeResize(capacity)
+	p.Capacity = capacity
+	n = len(p.Jobs) + len(p.held) - maxInt(capacity, 1)
+	if mode == CloseHard && n > 0 {
+		evicted = p.evict(n, q)
+	}
+	D("Processor", p.ProcessorId, "was resized to", capacity)
+	p.afterResize(evicted)
+	p.Pull()
+	return evicted
+}
+
+// evict takes the n Jobs that were started most recently out of service
+// and Prepends them to q, if q isn't nil. Held Jobs count as started after
+// the ones in service, so they go first; they've already been interrupted
+// by Fail and have no pending finish to call off.
+func (p *Processor) evict(n int, q *Queue) (evicted []*Job) {
+	var i int
+	var j *Job
+	for n > 0 && len(p.held) > 0 {
+		j = p.held[len(p.held)-1]
+		p.held = p.held[:len(p.held)-1]
+		evicted = append(evicted, j)
+		if q != nil {
+			q.Prepend(j)
+		}
+		n--
+	}
+	if len(p.held) == 0 {
+		p.held = nil
+	}
+	for i = len(p.Jobs) - 1; i >= len(p.Jobs)-n; i-- {
+		j = p.Jobs[i]
+		for _, hook := range p.evictHooks {
+			hook(p, j)
+		}
+		j.interrupt(p.Preemption == PreemptResume)
+		evicted = append(evicted, j)
+		if q != nil {
+			q.Prepend(j)
+		}
+	}
+	p.Jobs = p.Jobs[:len(p.Jobs)-n]
+	p.CurrentJob = nil
+	if len(p.Jobs) > 0 {
+		p.CurrentJob = p.Jobs[0]
+	}
+	return evicted
+}
+
+// SetDiscipline makes d the Discipline that decides which Job the Processor
+// works on next. The Processor's old Discipline, if any, is detached first.
+// Passing nil leaves the Processor without a Discipline, in which case Jobs
+// are only started when something calls Start.
+func (p *Processor) SetDiscipline(d Discipline) {
+	if p.discipline == d {
+		return
+	}
+	if p.discipline != nil {
+		p.discipline.Detach(p)
+	}
+	p.discipline = d
+	if d != nil {
+		d.Attach(p)
+	}
+}
+
+// Discipline returns the Processor's Discipline, or nil if it doesn't have
+// one.
+func (p *Processor) Discipline() Discipline {
+	return p.discipline
+}
+
+// Pull asks the Processor's Discipline for Jobs and starts them until the
+// Processor is full or the Discipline has nothing more for it. It returns
+// the number of Jobs started.
+//
+// Pull is called automatically whenever the Processor finishes a Job, after
+// the AfterFinish callbacks have run.
+//
+// Before asking its Discipline, Pull restarts any Jobs still held from a
+// failure that the Processor didn't have room for when it was repaired.
+func (p *Processor) Pull() (n int) {
+	var j *Job
+	n = p.resumeHeld()
+	for p.discipline != nil && p.FreeSlots() > 0 {
+		j = p.discipline.Next(p)
+		if j == nil {
+			break
+		}
+		p.Start(j)
+		n++
+	}
+	return n
+}
+
 // IsIdle returns a boolean indicating whether the Processor is available to
 // start a new Job.
+//
+// For a Processor whose Capacity is greater than 1, this means that at least
+// one of its slots is free; the Processor may still be working on other
+// Jobs. A Processor that's down or closed is never idle.
 func (p *Processor) IsIdle() bool {
-	return p.CurrentJob == nil
+	return p.FreeSlots() > 0
+}
+
+// LastClass returns the Class of the Job the Processor started most
+// recently, which is what its Setup is measured from. If the Processor
+// hasn't started any Jobs yet, LastClass returns "".
+func (p *Processor) LastClass() string {
+	return p.lastClass
+}
+
+// InService returns the number of Jobs the Processor is working on.
+func (p *Processor) InService() int {
+	return len(p.Jobs)
+}
+
+// FreeSlots returns the number of additional Jobs the Processor could start
+// right now. A Processor that's down or closed has no free slots.
+func (p *Processor) FreeSlots() int {
+	var c int
+	if p.down || p.closed {
+		return 0
+	}
+	c = p.Capacity
+	if c < 1 {
+		c = 1
+	}
+	if len(p.Jobs) >= c {
+		return 0
+	}
+	return c - len(p.Jobs)
 }
 
 // BeforeStart adds a callback to be run immediately before a Job is started
@@ -141,9 +650,224 @@ func (p *Processor) afterFinish(j *Job) {
 	}
 }
 
+// BeforePreempt adds a callback to be run immediately before a Job is
+// evicted from the Processor by Preempt.
+//
+// The callback will be passed the processor itself, the job that's about to
+// be started, and the job that's about to be evicted. If Preempt finds a
+// free slot and doesn't need to evict anything, the callback doesn't run.
+func (p *Processor) BeforePreempt(f func(p *Processor, newJob, evicted *Job)) {
+	p.cbBeforePreempt = append(p.cbBeforePreempt, f)
+}
+func (p *Processor) beforePreempt(newJob, evicted *Job) {
+	for _, cb := range p.cbBeforePreempt {
+		cb(p, newJob, evicted)
+	}
+}
+
+// AfterPreempt adds a callback to be run immediately after a Job has been
+// evicted from the Processor by Preempt and the new Job has been started
+// in its place.
+//
+// The callback will be passed the processor itself, the job that was
+// started, and the job that was evicted. If Preempt finds a free slot and
+// doesn't need to evict anything, the callback doesn't run.
+func (p *Processor) AfterPreempt(f func(p *Processor, newJob, evicted *Job)) {
+	p.cbAfterPreempt = append(p.cbAfterPreempt, f)
+}
+func (p *Processor) afterPreempt(newJob, evicted *Job) {
+	for _, cb := range p.cbAfterPreempt {
+		cb(p, newJob, evicted)
+	}
+}
+
+// BeforeFail adds a callback to be run immediately before the Processor
+// fails.
+//
+// The callback will be passed the processor itself. The Jobs it's working
+// on are still in service when the callback runs. If Fail is called on a
+// Processor that's already down, the callback doesn't run.
+func (p *Processor) BeforeFail(f func(p *Processor)) {
+	p.cbBeforeFail = append(p.cbBeforeFail, f)
+}
+func (p *Processor) beforeFail() {
+	for _, cb := range p.cbBeforeFail {
+		cb(p)
+	}
+}
+
+// AfterFail adds a callback to be run immediately after the Processor
+// fails.
+//
+// The callback will be passed the processor itself and the Jobs that were
+// lost (which, unless the Processor's FailPolicy is FailLose, will be
+// none).
+func (p *Processor) AfterFail(f func(p *Processor, lost []*Job)) {
+	p.cbAfterFail = append(p.cbAfterFail, f)
+}
+func (p *Processor) afterFail(lost []*Job) {
+	for _, cb := range p.cbAfterFail {
+		cb(p, lost)
+	}
+}
+
+// BeforeRepair adds a callback to be run immediately before the Processor
+// is repaired.
+//
+// The callback will be passed the processor itself. If Repair is called on
+// a Processor that isn't down, the callback doesn't run.
+func (p *Processor) BeforeRepair(f func(p *Processor)) {
+	p.cbBeforeRepair = append(p.cbBeforeRepair, f)
+}
+func (p *Processor) beforeRepair() {
+	for _, cb := range p.cbBeforeRepair {
+		cb(p)
+	}
+}
+
+// AfterRepair adds a callback to be run immediately after the Processor is
+// repaired.
+//
+// The callback will be passed the processor itself. By the time it runs,
+// the Jobs that were interrupted by the failure have been started again,
+// but the Processor hasn't pulled any new ones from its Discipline yet.
+func (p *Processor) AfterRepair(f func(p *Processor)) {
+	p.cbAfterRepair = append(p.cbAfterRepair, f)
+}
+func (p *Processor) afterRepair() {
+	for _, cb := range p.cbAfterRepair {
+		cb(p)
+	}
+}
+
+// BeforeClose adds a callback to be run immediately before the Processor
+// is closed.
+//
+// The callback will be passed the processor itself. The Jobs it's working
+// on are still in service when the callback runs. If Close is called on a
+// Processor that's already closed and has nothing to evict, the callback
+// doesn't run.
+func (p *Processor) BeforeClose(f func(p *Processor)) {
+	p.cbBeforeClose = append(p.cbBeforeClose, f)
+}
+func (p *Processor) beforeClose() {
+	for _, cb := range p.cbBeforeClose {
+		cb(p)
+	}
+}
+
+// AfterClose adds a callback to be run immediately after the Processor is
+// closed.
+//
+// The callback will be passed the processor itself and the Jobs that were
+// evicted (which, unless the Processor was closed with CloseHard, will be
+// none).
+func (p *Processor) AfterClose(f func(p *Processor, evicted []*Job)) {
+	p.cbAfterClose = append(p.cbAfterClose, f)
+}
+func (p *Processor) afterClose(evicted []*Job) {
+	for _, cb := range p.cbAfterClose {
+		cb(p, evicted)
+	}
+}
+
+// BeforeOpen adds a callback to be run immediately before the Processor is
+// opened.
+//
+// The callback will be passed the processor itself. If Open is called on a
+// Processor that isn't closed, the callback doesn't run.
+func (p *Processor) BeforeOpen(f func(p *Processor)) {
+	p.cbBeforeOpen = append(p.cbBeforeOpen, f)
+}
+func (p *Processor) beforeOpen() {
+	for _, cb := range p.cbBeforeOpen {
+		cb(p)
+	}
+}
+
+// AfterOpen adds a callback to be run immediately after the Processor is
+// opened.
+//
+// The callback will be passed the processor itself. By the time it runs,
+// the Processor hasn't pulled any new Jobs from its Discipline yet.
+func (p *Processor) AfterOpen(f func(p *Processor)) {
+	p.cbAfterOpen = append(p.cbAfterOpen, f)
+}
+func (p *Processor) afterOpen() {
+	for _, cb := range p.cbAfterOpen {
+		cb(p)
+	}
+}
+
+// BeforeResize adds a callback to be run immediately before the
+// Processor's Capacity is changed with Resize.
+//
+// The callback will be passed the processor itself and the new Capacity.
+// The old one is still in p.Capacity.
+func (p *Processor) BeforeResize(f func(p *Processor, capacity int)) {
+	p.cbBeforeResize = append(p.cbBeforeResize, f)
+}
+func (p *Processor) beforeResize(capacity int) {
+	for _, cb := range p.cbBeforeResize {
+		cb(p, capacity)
+	}
+}
+
+// AfterResize adds a callback to be run immediately after the Processor's
+// Capacity is changed with Resize.
+//
+// The callback will be passed the processor itself and the Jobs that were
+// evicted, if any. By the time it runs, the Processor hasn't pulled any
+// new Jobs from its Discipline yet.
+func (p *Processor) AfterResize(f func(p *Processor, evicted []*Job)) {
+	p.cbAfterResize = append(p.cbAfterResize, f)
+}
+func (p *Processor) afterResize(evicted []*Job) {
+	for _, cb := range p.cbAfterResize {
+		cb(p, evicted)
+	}
+}
+
+// BeforeSetup adds a callback to be run immediately before the Processor
+// works out how long it needs to get ready for a Job.
+//
+// The callback will be passed the processor itself and the job that's
+// being started. p.LastClass() still gives the Class of the Job before it.
+// The callback only runs if the Processor has a Setup, and not for Jobs
+// that are resuming after a preemption or failure.
+func (p *Processor) BeforeSetup(f func(p *Processor, j *Job)) {
+	p.cbBeforeSetup = append(p.cbBeforeSetup, f)
+}
+func (p *Processor) beforeSetup(j *Job) {
+	for _, cb := range p.cbBeforeSetup {
+		cb(p, j)
+	}
+}
+
+// AfterSetup adds a callback to be run immediately after the Processor has
+// worked out how long it needs to get ready for a Job, and before the
+// AfterStart callbacks run.
+//
+// The callback will be passed the processor itself, the job that's being
+// started, and the setup time, which may be 0. The procTime passed to the
+// AfterStart callbacks includes the setup time.
+func (p *Processor) AfterSetup(f func(p *Processor, j *Job, setupTime int)) {
+	p.cbAfterSetup = append(p.cbAfterSetup, f)
+}
+func (p *Processor) afterSetup(j *Job, setupTime int) {
+	for _, cb := range p.cbAfterSetup {
+		cb(p, j, setupTime)
+	}
+}
+
+func (p *Processor) bindSimulation(sim *Simulation) {
+	p.sim = sim
+}
+
 // NewProcessor creates a new Processor struct.
 func NewProcessor(procTimeGenerator func(j *Job) int) (p *Processor) {
 	p = new(Processor)
+	p.Capacity = 1
 	p.SetProcTimeGenerator(procTimeGenerator)
 	return
 }
@@ -138,6 +138,10 @@ func TestAfterStart(t *testing.T) {
 		t.Log("AfterStart callback called with wrong Job")
 		t.Fail()
 	}
+	if receivedProcTime != 293 {
+		t.Log("AfterStart callback called with wrong procTime", receivedProcTime)
+		t.Fail()
+	}
 
 	// Make sure that, if Start is called on a busy Processor, the callback
 	// still runs but returns nil.
@@ -230,3 +234,550 @@ func TestAfterFinish(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// Tests a Processor that can work on several Jobs at once.
+func TestProcessorCapacity(t *testing.T) {
+	t.Parallel()
+	var proc *Processor
+	var jobs []*Job
+	var i int
+	var err error
+
+	proc = NewProcessor(simplePtg)
+	proc.Capacity = 3
+	for i = 0; i < 3; i++ {
+		jobs = append(jobs, NewJob(0))
+		if !proc.IsIdle() || proc.FreeSlots() != 3-i {
+			t.Log("Expected", 3-i, "free slots but got", proc.FreeSlots())
+			t.Fail()
+		}
+		if _, err = proc.Start(jobs[i]); err != nil {
+			t.Log("Got unexpected error starting Job", i, ":", err)
+			t.Fail()
+		}
+	}
+	if proc.IsIdle() || proc.InService() != 3 {
+		t.Log("Expected a full Processor but it has", proc.InService(), "Jobs in service")
+		t.Fail()
+	}
+	if _, err = proc.Start(NewJob(0)); err == nil {
+		t.Log("Expected an error starting a Job on a full Processor")
+		t.Fail()
+	}
+
+	// Finish a Job in the middle; the others keep going.
+	if proc.FinishJob(jobs[1]) != jobs[1] {
+		t.Log("FinishJob didn't return the Job it finished")
+		t.Fail()
+	}
+	if proc.InService() != 2 || proc.Jobs[0] != jobs[0] || proc.Jobs[1] != jobs[2] || proc.CurrentJob != jobs[0] {
+		t.Log("Wrong Jobs left in service after FinishJob:", proc.Jobs)
+		t.Fail()
+	}
+	if proc.FinishJob(jobs[1]) != nil {
+		t.Log("FinishJob on a Job that isn't in service should return nil")
+		t.Fail()
+	}
+
+	// Finish finishes the Job that's been in service the longest.
+	if proc.Finish() != jobs[0] || proc.CurrentJob != jobs[2] {
+		t.Log("Finish didn't finish the oldest Job")
+		t.Fail()
+	}
+}
+
+// Tests that a multi-server Processor in a running Simulation finishes each
+// Job on time.
+func TestProcessorCapacitySimulation(t *testing.T) {
+	t.Parallel()
+	var sys *funcSystem
+	var finished, maxInService int
+
+	sys = &funcSystem{InitFunc: func(sys *funcSystem) {
+		p := NewProcessor(func(j *Job) int { return 25 })
+		p.Capacity = 3
+		p.AfterStart(func(p *Processor, j *Job, procTime int) {
+			if p.InService() > maxInService {
+				maxInService = p.InService()
+			}
+		})
+		p.AfterFinish(func(p *Processor, j *Job) {
+			finished++
+			if j.SojournTime() != 25 || j.WaitTime() != 0 {
+				t.Log("Job arriving at", j.ArrTime, "should've gone straight through in 25 ticks but took", j.SojournTime())
+				t.Fail()
+			}
+		})
+		sys.Procs = []*Processor{p}
+		sys.AP = NewConstantArrProc(10)
+		sys.AB = NewShortestQueueArrBeh([]*Queue{NewQueue()}, sys.Procs, sys.AP)
+	}}
+	RunSimulation(sys, 1000, WithSeed(1))
+
+	if maxInService != 3 {
+		t.Log("Expected 3 Jobs in service at once but saw at most", maxInService)
+		t.Fail()
+	}
+	if finished < 95 {
+		t.Log("Expected about 98 Jobs to finish but only", finished, "did")
+		t.Fail()
+	}
+}
+
+// Tests that Preempt evicts the lowest-priority Job, puts it back at the
+// head of the Queue, and keeps track of the work it has left.
+func TestProcessorPreempt(t *testing.T) {
+	t.Parallel()
+	var sim *Simulation
+	var p *Processor
+	var q *Queue
+	var low, high, evicted *Job
+	var procTime, nBefore, nAfter int
+	var err error
+
+	sim = NewSimulation(&GrocerySystem{}, WithSeed(1))
+	p = NewProcessor(simplePtg)
+	p.bindSimulation(sim)
+	p.BeforePreempt(func(p *Processor, newJob, evicted *Job) {
+		nBefore++
+		if p.CurrentJob != evicted {
+			t.Log("BeforePreempt should run while the evicted Job is still in service")
+			t.Fail()
+		}
+	})
+	p.AfterPreempt(func(p *Processor, newJob, evicted *Job) {
+		nAfter++
+	})
+	q = NewQueue()
+	q.Append(sim.NewJob())
+
+	low = sim.NewJob()
+	p.Start(low)
+	sim.clock = 100
+	high = sim.NewJob()
+	high.Priority = 1
+	evicted, procTime, err = p.Preempt(high, q)
+	if err != nil || evicted != low || procTime != 293 || p.CurrentJob != high {
+		t.Log("Expected high-priority Job to evict the low-priority one")
+		t.Fail()
+	}
+	if q.Length() != 2 || q.Jobs[0] != low {
+		t.Log("Expected evicted Job at the head of the Queue")
+		t.Fail()
+	}
+	if low.RemainingTime != 193 || low.Preemptions != 1 {
+		t.Log("Expected 193 ticks remaining after 1 preemption but got", low.RemainingTime, "after", low.Preemptions)
+		t.Fail()
+	}
+	if nBefore != 1 || nAfter != 1 {
+		t.Log("Expected Preempt callbacks to run once each but got", nBefore, "and", nAfter)
+		t.Fail()
+	}
+
+	// The evicted Job picks up where it left off.
+	sim.clock = 393
+	p.Finish()
+	q.Shift()
+	procTime, _ = p.Start(low)
+	if procTime != 193 || low.RemainingTime != -1 || low.ServiceTime != 293 || low.StartTime != 0 {
+		t.Log("Expected resumed Job to need 193 more ticks but got", procTime)
+		t.Fail()
+	}
+	if low.WaitTime() != 293 {
+		t.Log("Expected resumed Job to have waited 293 ticks but got", low.WaitTime())
+		t.Fail()
+	}
+
+	// With PreemptRestart, the work is thrown away.
+	p.Preemption = PreemptRestart
+	sim.clock = 400
+	evicted, _, _ = p.Preempt(sim.NewJob(), nil)
+	if evicted != low || low.RemainingTime != -1 || q.Length() != 1 {
+		t.Log("Expected restarted Job to have no remaining time and to be left out of the Queue")
+		t.Fail()
+	}
+	sim.clock = 500
+	p.Finish()
+	if procTime, _ = p.Start(low); procTime != 293 {
+		t.Log("Expected restarted Job to draw a new processing time but got", procTime)
+		t.Fail()
+	}
+
+	// A Processor with a free slot doesn't need to evict anybody.
+	p.Capacity = 2
+	if evicted, _, _ = p.Preempt(sim.NewJob(), q); evicted != nil || nBefore != 2 {
+		t.Log("Expected Preempt on a Processor with a free slot to evict nothing")
+		t.Fail()
+	}
+}
+
+// Tests that a preempted Job's pending finish is called off in a running
+// Simulation, and that it finishes once its remaining work is done.
+func TestProcessorPreemptSimulation(t *testing.T) {
+	t.Parallel()
+	var sys *funcSystem
+	var first, second *Job
+	var finished []*Job
+
+	sys = &funcSystem{InitFunc: func(sys *funcSystem) {
+		q := NewQueue()
+		p := NewProcessor(func(j *Job) int { return 100 })
+		p.AfterStart(func(p *Processor, j *Job, procTime int) {
+			if first == nil {
+				first = j
+			}
+		})
+		p.AfterFinish(func(p *Processor, j *Job) {
+			finished = append(finished, j)
+		})
+		sys.Procs = []*Processor{p}
+		sys.AP = NewConstantArrProc(1000)
+		sys.AB = NewSharedQueueArrBeh(q, sys.Procs, sys.AP)
+		NewSharedQueueDiscipline(q, sys.Procs)
+		sys.Sim.ScheduleAt(40, func(clock int) {
+			second = sys.Sim.NewJob()
+			p.Preempt(second, q)
+		})
+	}}
+	RunSimulation(sys, 500, WithSeed(1))
+
+	if len(finished) != 2 || finished[0] != second || finished[1] != first {
+		t.Fatal("Expected the preempting Job to finish first, then the preempted one, but got", finished)
+	}
+	if second.DepartTime != 140 || first.DepartTime != 200 {
+		t.Log("Expected Jobs to finish at 140 and 200 but got", second.DepartTime, "and", first.DepartTime)
+		t.Fail()
+	}
+	if first.WaitTime() != 100 || first.SojournTime() != 200 {
+		t.Log("Expected preempted Job to wait 100 ticks and spend 200 in the system but got", first.WaitTime(), "and", first.SojournTime())
+		t.Fail()
+	}
+}
+
+// Tests that a Processor that fails stops working until it's repaired, and
+// that its FailPolicy decides what becomes of the Jobs in service.
+func TestProcessorFail(t *testing.T) {
+	t.Parallel()
+	var sim *Simulation
+	var p *Processor
+	var j *Job
+	var lost []*Job
+	var procTime, nBeforeFail, nAfterRepair int
+	var err error
+
+	sim = NewSimulation(&GrocerySystem{}, WithSeed(1))
+	p = NewProcessor(simplePtg)
+	p.bindSimulation(sim)
+	p.BeforeFail(func(p *Processor) {
+		nBeforeFail++
+		if p.InService() != 1 {
+			t.Log("BeforeFail should run while the Job is still in service")
+			t.Fail()
+		}
+	})
+	p.AfterRepair(func(p *Processor) {
+		nAfterRepair++
+	})
+
+	j = sim.NewJob()
+	p.Start(j)
+	sim.clock = 100
+	if lost = p.Fail(); len(lost) != 0 || !p.IsDown() || p.IsIdle() || p.InService() != 0 {
+		t.Log("Expected Processor to be down, not idle, and empty after failing")
+		t.Fail()
+	}
+	if _, err = p.Start(sim.NewJob()); err == nil {
+		t.Log("Expected an error starting a Job on a Processor that's down")
+		t.Fail()
+	}
+	p.Fail()
+	sim.clock = 150
+	p.AfterStart(func(p *Processor, j *Job, pt int) { procTime = pt })
+	p.Repair()
+	if p.IsDown() || p.CurrentJob != j || procTime != 193 || nBeforeFail != 1 || nAfterRepair != 1 {
+		t.Log("Expected the Job to resume with 193 ticks to go after the repair but got", procTime)
+		t.Fail()
+	}
+
+	p.FailPolicy = FailRestart
+	p.Fail()
+	p.Repair()
+	if p.CurrentJob != j || procTime != 293 {
+		t.Log("Expected the Job to start over after the repair but got", procTime)
+		t.Fail()
+	}
+
+	p.FailPolicy = FailLose
+	if lost = p.Fail(); len(lost) != 1 || lost[0] != j {
+		t.Log("Expected the Job to be lost")
+		t.Fail()
+	}
+	p.Repair()
+	if !p.IsIdle() {
+		t.Log("Expected the Processor to be idle after losing its Job")
+		t.Fail()
+	}
+}
+
+// Tests that the Jobs a Processor holds while it's down are evicted by a
+// hard Close or Resize, and otherwise wait until there's room for them.
+func TestProcessorFailAndClose(t *testing.T) {
+	t.Parallel()
+	var sim *Simulation
+	var p *Processor
+	var q *Queue
+	var j1, j2 *Job
+	var evicted []*Job
+
+	sim = NewSimulation(&GrocerySystem{}, WithSeed(1))
+	setup := func(capacity int) {
+		q = NewQueue()
+		p = NewProcessor(simplePtg)
+		p.Capacity = capacity
+		p.bindSimulation(sim)
+		j1, j2 = sim.NewJob(), sim.NewJob()
+		p.Start(j1)
+		if capacity > 1 {
+			p.Start(j2)
+		}
+		p.Fail()
+	}
+
+	// A hard close evicts the held Jobs.
+	setup(2)
+	evicted = p.Close(CloseHard, q)
+	if len(evicted) != 2 || q.Length() != 2 || q.Jobs[0] != j1 || q.Jobs[1] != j2 {
+		t.Log("Expected a hard close to put both held Jobs back in the Queue but it evicted", len(evicted))
+		t.Fail()
+	}
+	p.Repair()
+	p.Open()
+	if p.InService() != 0 || len(p.held) != 0 {
+		t.Log("Expected nothing to be restarted once the held Jobs were evicted")
+		t.Fail()
+	}
+
+	// A graceful close keeps the held Job until the Processor opens.
+	setup(1)
+	if evicted = p.Close(CloseGraceful, q); len(evicted) != 0 {
+		t.Log("Expected a graceful close to evict nothing")
+		t.Fail()
+	}
+	p.Repair()
+	if p.InService() != 0 || len(p.held) != 1 {
+		t.Log("Expected the Job to stay held while the Processor is closed")
+		t.Fail()
+	}
+	p.Open()
+	if p.CurrentJob != j1 || len(p.held) != 0 {
+		t.Log("Expected the held Job to be restarted once the Processor opened")
+		t.Fail()
+	}
+
+	// A hard shrink evicts the held Job that was started last.
+	setup(2)
+	evicted = p.Resize(1, CloseHard, q)
+	if len(evicted) != 1 || evicted[0] != j2 || q.Length() != 1 || q.Jobs[0] != j2 {
+		t.Log("Expected a hard shrink to put the last held Job back in the Queue")
+		t.Fail()
+	}
+	p.Repair()
+	if p.InService() != 1 || p.CurrentJob != j1 {
+		t.Log("Expected the other held Job to be restarted after the repair")
+		t.Fail()
+	}
+
+	// A graceful shrink restarts as many as fit, and the rest once there's
+	// room.
+	setup(2)
+	p.Resize(1, CloseGraceful, q)
+	p.Repair()
+	if p.InService() != 1 || p.CurrentJob != j1 || len(p.held) != 1 {
+		t.Log("Expected one held Job to be restarted and the other to stay held")
+		t.Fail()
+	}
+	p.Finish()
+	if p.InService() != 1 || p.CurrentJob != j2 || len(p.held) != 0 || q.Length() != 0 {
+		t.Log("Expected the second held Job to be restarted once the first finished")
+		t.Fail()
+	}
+}
+
+// Tests closing a Processor gracefully and hard, opening it again, and
+// resizing it.
+func TestProcessorClose(t *testing.T) {
+	t.Parallel()
+	var sim *Simulation
+	var p *Processor
+	var q *Queue
+	var j1, j2 *Job
+	var evicted []*Job
+	var err error
+
+	sim = NewSimulation(&GrocerySystem{}, WithSeed(1))
+	q = NewQueue()
+	p = NewProcessor(simplePtg)
+	p.Capacity = 2
+	p.bindSimulation(sim)
+	j1, j2 = sim.NewJob(), sim.NewJob()
+	p.Start(j1)
+	sim.clock = 50
+	p.Start(j2)
+	sim.clock = 100
+
+	if evicted = p.Close(CloseGraceful, q); len(evicted) != 0 || !p.IsClosed() || p.IsIdle() || p.InService() != 2 {
+		t.Log("Expected a graceful close to leave both Jobs in service and the Processor not idle")
+		t.Fail()
+	}
+	if _, err = p.Start(sim.NewJob()); err == nil {
+		t.Log("Expected an error starting a Job on a Processor that's closed")
+		t.Fail()
+	}
+	evicted = p.Close(CloseHard, q)
+	if len(evicted) != 2 || p.InService() != 0 || p.CurrentJob != nil {
+		t.Log("Expected a hard close to evict both Jobs but it evicted", len(evicted))
+		t.Fail()
+	}
+	if q.Length() != 2 || q.Jobs[0] != j1 || q.Jobs[1] != j2 {
+		t.Log("Expected the evicted Jobs to be put back in the Queue in the order they were started")
+		t.Fail()
+	}
+	if j1.RemainingTime != 193 || j2.RemainingTime != 243 {
+		t.Log("Expected the evicted Jobs to have 193 and 243 ticks to go but got", j1.RemainingTime, "and", j2.RemainingTime)
+		t.Fail()
+	}
+
+	p.Open()
+	if p.IsClosed() || p.FreeSlots() != 2 {
+		t.Log("Expected the Processor to have 2 free slots after opening")
+		t.Fail()
+	}
+	p.Start(j1)
+	p.Start(j2)
+	if evicted = p.Resize(1, CloseHard, nil); len(evicted) != 1 || evicted[0] != j2 || p.CurrentJob != j1 {
+		t.Log("Expected resizing to 1 to evict the Job that was started last")
+		t.Fail()
+	}
+	if evicted = p.Resize(3, CloseGraceful, nil); len(evicted) != 0 || p.FreeSlots() != 2 {
+		t.Log("Expected the Processor to have 2 free slots after resizing to 3")
+		t.Fail()
+	}
+}
+
+// Tests that Preempt leaves a Processor that's closed or down alone.
+func TestProcessorPreemptClosed(t *testing.T) {
+	t.Parallel()
+	var sim *Simulation
+	var p *Processor
+	var q *Queue
+	var j *Job
+	var evicted *Job
+	var nPreempt int
+	var err error
+
+	sim = NewSimulation(&GrocerySystem{}, WithSeed(1))
+	q = NewQueue()
+	p = NewProcessor(simplePtg)
+	p.bindSimulation(sim)
+	p.AfterPreempt(func(p *Processor, newJob, evicted *Job) {
+		nPreempt++
+	})
+	j = sim.NewJob()
+	p.Start(j)
+
+	p.Close(CloseGraceful, q)
+	if evicted, _, err = p.Preempt(sim.NewJob(), q); err == nil || evicted != nil {
+		t.Log("Expected an error preempting a Processor that's closed")
+		t.Fail()
+	}
+	if p.InService() != 1 || p.Jobs[0] != j || q.Length() != 0 {
+		t.Log("Expected the Job in service to be left alone")
+		t.Fail()
+	}
+
+	p.Open()
+	p.Fail()
+	if evicted, _, err = p.Preempt(sim.NewJob(), q); err == nil || evicted != nil {
+		t.Log("Expected an error preempting a Processor that's down")
+		t.Fail()
+	}
+	if p.InService() != 0 || len(p.held) != 1 || q.Length() != 0 {
+		t.Log("Expected the Job interrupted by the failure to be left alone")
+		t.Fail()
+	}
+	if nPreempt != 0 {
+		t.Log("Expected no AfterPreempt callbacks but got", nPreempt)
+		t.Fail()
+	}
+}
+
+// Tests that Preempt leaves a Processor alone when it's still over its
+// Capacity after being shrunk, since evicting one Job wouldn't make room.
+func TestProcessorPreemptOverCapacity(t *testing.T) {
+	t.Parallel()
+	var p *Processor
+	var q *Queue
+	var newJob, evicted *Job
+	var err error
+
+	q = NewQueue()
+	p = NewProcessor(simplePtg)
+	p.Capacity = 2
+	p.Start(NewJob(0))
+	p.Start(NewJob(0))
+	p.Capacity = 1
+
+	newJob = NewJob(0)
+	if evicted, _, err = p.Preempt(newJob, q); err == nil || evicted != nil {
+		t.Log("Expected an error preempting a Processor that's over its Capacity")
+		t.Fail()
+	}
+	if p.InService() != 2 || q.Length() != 0 || newJob.Preemptions != 0 {
+		t.Log("Expected the Jobs in service to be left alone")
+		t.Fail()
+	}
+	for _, j := range p.Jobs {
+		if j == newJob || j.Preemptions != 0 {
+			t.Log("Expected the Jobs in service to be left alone")
+			t.Fail()
+		}
+	}
+}
+
+// Tests that a Processor adds setup time when the Class of Job changes, and
+// reports it separately.
+func TestProcessorSetup(t *testing.T) {
+	t.Parallel()
+	var p *Processor
+	var j *Job
+	var procTime, nBeforeSetup, setupTime int
+	var class string
+
+	p = NewProcessor(simplePtg)
+	p.Setup = SetupMatrix{
+		"":  {"a": 5},
+		"a": {"b": 20},
+		"b": {"a": 30},
+	}
+	p.BeforeSetup(func(p *Processor, j *Job) {
+		nBeforeSetup++
+	})
+	p.AfterSetup(func(p *Processor, j *Job, st int) {
+		setupTime = st
+	})
+
+	for _, class = range []string{"a", "a", "b", "a"} {
+		j = NewJob(0)
+		j.Class = class
+		procTime, _ = p.Start(j)
+		if procTime != 293+j.SetupTime || j.ServiceTime != 293 || setupTime != j.SetupTime {
+			t.Log("Expected the setup time to be added to the processing time but recorded separately")
+			t.Fail()
+		}
+		p.Finish()
+	}
+	if j.SetupTime != 30 || p.LastClass() != "a" || nBeforeSetup != 4 {
+		t.Log("Expected a 30-tick setup going from 'b' to 'a' but got", j.SetupTime)
+		t.Fail()
+	}
+}
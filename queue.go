@@ -20,6 +20,13 @@ type Queue struct {
 	// until the Queue's length is back under MaxLength.
 	MaxLength int
 
+	// Ordering decides which Job Shift takes out of the Queue. The
+	// default, nil, is the same as FIFO: Jobs are shifted from the head of
+	// the Queue. Jobs are always appended to the tail, so q.Jobs stays in
+	// the order in which the Jobs arrived no matter what the Ordering is.
+	// The exception is Jobs put back at the head with Prepend.
+	Ordering Ordering
+
 	// Callback lists
 	cbBeforeAppend []func(q *Queue, j *Job)
 	cbAfterAppend  []func(q *Queue, j *Job)
@@ -30,14 +37,45 @@ type Queue struct {
 }
 
 // Append adds a Job to the tail of the queue.
+//
+// The Job's Queue and EnqueueTime fields are set accordingly.
 func (q *Queue) Append(j *Job) {
+	q.insert(j, false)
+}
+
+// Prepend adds a Job to the head of the queue, ahead of the Jobs that are
+// already waiting. It's meant for putting back a Job that was interrupted
+// in the middle of service (see Processor.Preempt).
+//
+// Other than that, Prepend works just like Append: it respects MaxLength,
+// sets the Job's Queue and EnqueueTime fields, and runs the BeforeAppend
+// and AfterAppend callbacks.
+func (q *Queue) Prepend(j *Job) {
+	q.insert(j, true)
+}
+
+// insert adds a Job to the head or tail of the queue.
+func (q *Queue) insert(j *Job, atHead bool) {
 	q.beforeAppend(j)
-	if q.MaxLength == -1 || q.Length() < q.MaxLength {
-		q.Jobs = append(q.Jobs, j)
-		q.afterAppend(j)
-	} else {
+	if q.IsFull() {
 		q.afterAppend(nil)
+		return
+	}
+	j.Queue = q
+	j.EnqueueTime = j.now()
+	j.queued = true
+	if atHead {
+		q.Jobs = append([]*Job{j}, q.Jobs...)
+	} else {
+		q.Jobs = append(q.Jobs, j)
 	}
+	q.afterAppend(j)
+}
+
+// IsFull returns true if the Queue is at (or over) its MaxLength, in which
+// case Jobs appended to it will be discarded.
+func (q *Queue) IsFull() bool {
+	return q.MaxLength != -1 && q.Length() >= q.MaxLength
 }
 
 // Length returns the current number of jobs in the queue.
@@ -45,7 +83,8 @@ func (q *Queue) Length() int {
 	return len(q.Jobs)
 }
 
-// Shift removes a Job from the head of the queue.
+// Shift removes a Job from the head of the queue, or from wherever the
+// Queue's Ordering says the next Job should come from.
 //
 // It returns the Job that was removed, as well as the number of Jobs
 // still left in the queue after shifting. When Shift is called on an
@@ -57,14 +96,28 @@ func (q *Queue) Length() int {
 //      // Do something with j
 //  }
 func (q *Queue) Shift() (j *Job, nrem int) {
+	var i int
 	if len(q.Jobs) == 0 {
 		q.beforeShift(nil)
 		q.afterShift(nil)
 		return nil, 0
 	}
-	j = q.Jobs[0]
+	if q.Ordering != nil {
+		i = q.Ordering.Pick(q)
+	}
+	return q.shiftAt(i)
+}
+
+// shiftAt shifts the Job at index i out of the queue, regardless of the
+// Queue's Ordering.
+func (q *Queue) shiftAt(i int) (j *Job, nrem int) {
+	j = q.Jobs[i]
 	q.beforeShift(j)
-	q.Jobs = q.Jobs[1:]
+	if i == 0 {
+		q.Jobs = q.Jobs[1:]
+	} else {
+		q.Jobs = append(q.Jobs[:i], q.Jobs[i+1:]...)
+	}
 	q.afterShift(j)
 	return j, len(q.Jobs)
 }
@@ -189,3 +242,15 @@ func NewQueue() (q *Queue) {
 	q.MaxLength = -1
 	return q
 }
+
+// NewPriorityQueue creates an empty Queue that serves Jobs in order of
+// Priority, highest first. Jobs with the same Priority are served in the
+// order in which they were appended. Jobs already in service are never
+// interrupted by higher-priority arrivals.
+//
+// This is shorthand for a Queue whose Ordering is HighestPriorityFirst.
+func NewPriorityQueue() (q *Queue) {
+	q = NewQueue()
+	q.Ordering = HighestPriorityFirst
+	return q
+}
@@ -565,3 +565,32 @@ func TestQueueAfterAppendWithMaxLength(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// Tests that a priority Queue serves the highest-priority Jobs first, and
+// Jobs of equal priority in FIFO order.
+func TestPriorityQueue(t *testing.T) {
+	t.Parallel()
+	var q *Queue
+	var j *Job
+	var i int
+	var priorities []int
+	var expOrder []int
+
+	q = NewPriorityQueue()
+	priorities = []int{0, 2, 1, 2, 0, 1}
+	for i = range priorities {
+		j = NewJob(0)
+		j.Priority = priorities[i]
+		j.IntAttrs["i"] = i
+		q.Append(j)
+	}
+
+	expOrder = []int{1, 3, 2, 5, 0, 4}
+	for i = range expOrder {
+		j, _ = q.Shift()
+		if j == nil || j.IntAttrs["i"] != expOrder[i] {
+			t.Log("Expected Job", expOrder[i], "to be shifted next but got", j)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package qsim
+
+import (
+	"math/rand"
+)
+
+// Built-in components that need random numbers draw them from a *rand.Rand
+// owned by the Simulation, so that runs with the same seed are
+// reproducible. When a component is used outside a Simulation and has no
+// *rand.Rand of its own, these helpers fall back to the global math/rand
+// functions.
+
+func randInt63(r *rand.Rand) int64 {
+	if r == nil {
+		return rand.Int63()
+	}
+	return r.Int63()
+}
+
+func randIntn(r *rand.Rand, n int) int {
+	if r == nil {
+		return rand.Intn(n)
+	}
+	return r.Intn(n)
+}
+
+func randFloat64(r *rand.Rand) float64 {
+	if r == nil {
+		return rand.Float64()
+	}
+	return r.Float64()
+}
+
+func randExpFloat64(r *rand.Rand) float64 {
+	if r == nil {
+		return rand.ExpFloat64()
+	}
+	return r.ExpFloat64()
+}
@@ -0,0 +1,97 @@
+package qsim
+
+// Reneging makes Jobs abandon a Queue when they've waited longer than they
+// were willing to: callers on hold who hang up, say, or web requests that
+// time out. Create one with NewReneging.
+//
+// Whenever a Job is appended to the Queue, Reneging draws the Job's patience
+// and schedules an abandonment for when it runs out. If the Job is still in
+// the Queue at that point, it's taken out with Queue.Remove and the
+// AfterRenege callbacks run. If it leaves the Queue before then (because it
+// was shifted out to start service, or removed some other way), the
+// abandonment is called off.
+type Reneging struct {
+	// The Queue whose Jobs may renege.
+	Queue *Queue
+	// Patience returns the number of ticks j is willing to wait in the
+	// Queue. If it returns a negative number, j waits as long as it takes.
+	Patience func(j *Job) int
+	// Reneged is the number of Jobs that have abandoned the Queue.
+	Reneged int
+	// RenegedByClass breaks Reneged down by Job Class.
+	RenegedByClass map[string]int
+
+	sim *Simulation
+	// The pending abandonment for each Job in the Queue.
+	timers map[*Job]*EventHandle
+	// Callback lists
+	cbAfterRenege []func(r *Reneging, j *Job)
+}
+
+// schedule arranges for j to abandon the Queue once its patience runs out.
+func (r *Reneging) schedule(j *Job) {
+	var patience int
+	patience = r.Patience(j)
+	if patience < 0 {
+		return
+	}
+	r.timers[j] = r.sim.ScheduleAfter(patience, func(clock int) {
+		delete(r.timers, j)
+		if k, _ := r.Queue.Remove(j); k == nil {
+			return
+		}
+		D("Job", j.JobId, "reneged from Queue", r.Queue)
+		r.Reneged++
+		r.RenegedByClass[j.Class]++
+		r.afterRenege(j)
+	})
+}
+
+// cancel calls off j's pending abandonment, if it has one.
+func (r *Reneging) cancel(j *Job) {
+	if h, ok := r.timers[j]; ok {
+		h.Cancel()
+		delete(r.timers, j)
+	}
+}
+
+// AfterRenege adds a callback to be run immediately after a Job abandons
+// the Queue.
+//
+// The callback will be passed the Reneging itself and the Job that
+// reneged. By the time the callback runs, the Job has already been removed
+// from the Queue.
+func (r *Reneging) AfterRenege(f func(r *Reneging, j *Job)) {
+	r.cbAfterRenege = append(r.cbAfterRenege, f)
+}
+func (r *Reneging) afterRenege(j *Job) {
+	for _, cb := range r.cbAfterRenege {
+		cb(r, j)
+	}
+}
+
+// NewReneging makes the Jobs appended to q in sim abandon it once they've
+// waited for longer than patience says they will.
+func NewReneging(sim *Simulation, q *Queue, patience func(j *Job) int) *Reneging {
+	var r *Reneging
+
+	r = &Reneging{Queue: q, Patience: patience, sim: sim}
+	r.RenegedByClass = make(map[string]int)
+	r.timers = make(map[*Job]*EventHandle)
+
+	q.AfterAppend(func(cbQueue *Queue, cbJob *Job) {
+		if cbJob != nil {
+			r.cancel(cbJob)
+			r.schedule(cbJob)
+		}
+	})
+	q.AfterShift(func(cbQueue *Queue, cbJob *Job) {
+		if cbJob != nil {
+			r.cancel(cbJob)
+		}
+	})
+	q.AfterRemove(func(cbQueue *Queue, cbJob *Job) {
+		r.cancel(cbJob)
+	})
+	return r
+}
@@ -0,0 +1,89 @@
+package qsim
+
+import (
+	"testing"
+)
+
+// Tests that Jobs renege once their patience runs out, and only if they
+// haven't started service by then.
+func TestReneging(t *testing.T) {
+	t.Parallel()
+	var sys *funcSystem
+	var q *Queue
+	var r *Reneging
+	var arrived, finished, reneged int
+
+	sys = &funcSystem{InitFunc: func(sys *funcSystem) {
+		q = NewQueue()
+		p := NewProcessor(func(j *Job) int { return 100 })
+		p.AfterFinish(func(p *Processor, j *Job) {
+			finished++
+			if j.WaitTime() > 35 {
+				t.Log("Job waited", j.WaitTime(), "ticks but should've reneged after 35")
+				t.Fail()
+			}
+		})
+		sys.Procs = []*Processor{p}
+		sys.AP = NewConstantArrProc(10)
+		sys.AP.AfterArrive(func(ap ArrProc, jobs []*Job, interval int) {
+			arrived += len(jobs)
+		})
+		sys.AB = NewSharedQueueArrBeh(q, sys.Procs, sys.AP)
+		NewSharedQueueDiscipline(q, sys.Procs)
+		r = NewReneging(sys.Sim, q, func(j *Job) int { return 35 })
+		r.AfterRenege(func(r *Reneging, j *Job) {
+			reneged++
+			if j.StartTime != -1 {
+				t.Log("Job", j.JobId, "reneged after it started service")
+				t.Fail()
+			}
+			for _, k := range q.Jobs {
+				if k == j {
+					t.Log("Job", j.JobId, "reneged without leaving the Queue")
+					t.Fail()
+				}
+			}
+			if sys.Sim.Clock() != j.EnqueueTime+35 {
+				t.Log("Job enqueued at", j.EnqueueTime, "reneged at", sys.Sim.Clock(), "instead of", j.EnqueueTime+35)
+				t.Fail()
+			}
+		})
+	}}
+	RunSimulation(sys, 1000, WithSeed(1))
+
+	if reneged == 0 || reneged != r.Reneged || r.RenegedByClass[""] != reneged {
+		t.Log("Expected AfterRenege to run once for each of", r.Reneged, "reneging Jobs but it ran", reneged, "times")
+		t.Fail()
+	}
+	if arrived != finished+reneged+q.Length()+sys.Procs[0].InService() {
+		t.Log("Expected all", arrived, "Jobs to be accounted for, but", finished, "finished,", reneged, "reneged, and", q.Length()+sys.Procs[0].InService(), "are still around")
+		t.Fail()
+	}
+	if len(r.timers) != q.Length() {
+		t.Log("Expected a pending abandonment for each of the", q.Length(), "queued Jobs but there are", len(r.timers))
+		t.Fail()
+	}
+}
+
+// Tests that a Job with negative patience never reneges.
+func TestRenegingInfinitePatience(t *testing.T) {
+	t.Parallel()
+	var sys *funcSystem
+	var q *Queue
+	var r *Reneging
+
+	sys = &funcSystem{InitFunc: func(sys *funcSystem) {
+		q = NewQueue()
+		sys.Procs = []*Processor{NewProcessor(func(j *Job) int { return 100 })}
+		sys.AP = NewConstantArrProc(10)
+		sys.AB = NewSharedQueueArrBeh(q, sys.Procs, sys.AP)
+		NewSharedQueueDiscipline(q, sys.Procs)
+		r = NewReneging(sys.Sim, q, func(j *Job) int { return -1 })
+	}}
+	RunSimulation(sys, 1000, WithSeed(1))
+
+	if r.Reneged != 0 || len(r.timers) != 0 || q.Length() == 0 {
+		t.Log("Expected Jobs to pile up without reneging, but", r.Reneged, "reneged")
+		t.Fail()
+	}
+}
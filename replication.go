@@ -0,0 +1,195 @@
+package qsim
+
+import (
+	"math/rand"
+	"runtime"
+	"sync"
+
+	"github.com/danslimmon/qsim/analysis"
+)
+
+// ReplicationOptions controls how RunReplications runs its replications.
+type ReplicationOptions struct {
+	// Workers is the maximum number of replications that will run at the
+	// same time. If Workers is 0, runtime.NumCPU() is used.
+	Workers int
+	// Seed determines the seed of every replication's Simulation. Each
+	// replication gets its own random number stream, derived from Seed,
+	// so the same Seed always yields the same results no matter how many
+	// Workers there are.
+	Seed int64
+}
+
+// A ReplicationResult holds the outcome of one replication.
+type ReplicationResult struct {
+	// Rep is the replication's index, from 0 to n-1.
+	Rep int
+	// Seed is the seed that was given to the replication's Simulation.
+	Seed int64
+	// Sys is the System that was simulated. You'll probably want to do a
+	// type assertion to get at your System's stats.
+	Sys System
+	// FinalTick is the value returned by Simulation.Run.
+	FinalTick int
+}
+
+// Replications is a list of ReplicationResults, in order of Rep. It has
+// some methods to help aggregate results across replications.
+type Replications []ReplicationResult
+
+// Values returns f(sys) for the System of each replication.
+func (reps Replications) Values(f func(sys System) float64) (vals []float64) {
+	var i int
+	var r ReplicationResult
+	vals = make([]float64, len(reps))
+	for i, r = range reps {
+		vals[i] = f(r.Sys)
+	}
+	return vals
+}
+
+// Sum returns the sum of f(sys) over all the replications.
+func (reps Replications) Sum(f func(sys System) float64) (sum float64) {
+	var v float64
+	for _, v = range reps.Values(f) {
+		sum += v
+	}
+	return sum
+}
+
+// Mean returns the mean of f(sys) over all the replications.
+func (reps Replications) Mean(f func(sys System) float64) float64 {
+	return reps.Sum(f) / float64(len(reps))
+}
+
+// SumInt returns the sum of f(sys) over all the replications.
+func (reps Replications) SumInt(f func(sys System) int) (sum int) {
+	var r ReplicationResult
+	for _, r = range reps {
+		sum += f(r.Sys)
+	}
+	return sum
+}
+
+// SumInts adds up the slices returned by f(sys), element by element, over
+// all the replications. The result is as long as the longest slice.
+func (reps Replications) SumInts(f func(sys System) []int) (sums []int) {
+	var r ReplicationResult
+	var i, v int
+	for _, r = range reps {
+		for i, v = range f(r.Sys) {
+			if i >= len(sums) {
+				sums = append(sums, 0)
+			}
+			sums[i] += v
+		}
+	}
+	return sums
+}
+
+// RunReplications runs n independent replications of a simulation, each for
+// maxTicks ticks, and returns the results in order.
+//
+// factory is called once per replication, with the replication's index, to
+// create a fresh System. Replications run in parallel on up to
+// opts.Workers goroutines, so factory and the Systems it creates must not
+// share mutable state.
+func RunReplications(factory func(rep int) System, n int, maxTicks int, opts ReplicationOptions) Replications {
+	var seeds []int64
+	var master *rand.Rand
+	var i int
+
+	master = rand.New(rand.NewSource(opts.Seed))
+	seeds = make([]int64, n)
+	for i = 0; i < n; i++ {
+		seeds[i] = master.Int63()
+	}
+	return runReplications(factory, 0, seeds, maxTicks, opts.workers())
+}
+
+// RunReplicationsUntil runs replications until the confidence interval for
+// the mean of metric(sys) satisfies rule, or until rule.MaxN replications
+// have run.
+//
+// Replications are run in rounds of opts.Workers at a time, so a few more
+// replications than strictly necessary may end up being run. Replication i
+// gets the same seed it would get from RunReplications with the same
+// opts.Seed.
+func RunReplicationsUntil(factory func(rep int) System, maxTicks int, metric func(sys System) float64, rule analysis.StoppingRule, opts ReplicationOptions) (reps Replications, iv analysis.Interval, ok bool) {
+	var master *rand.Rand
+	var seeds []int64
+	var workers, n, i int
+
+	master = rand.New(rand.NewSource(opts.Seed))
+	workers = opts.workers()
+	for {
+		// Run enough replications to satisfy MinN, then a round at a time.
+		n = workers
+		if len(reps)+n < rule.MinN {
+			n = rule.MinN - len(reps)
+		}
+		if len(reps)+n < 2 {
+			n = 2 - len(reps)
+		}
+		if rule.MaxN > 0 && len(reps)+n > rule.MaxN {
+			n = rule.MaxN - len(reps)
+		}
+		seeds = make([]int64, n)
+		for i = 0; i < n; i++ {
+			seeds[i] = master.Int63()
+		}
+		reps = append(reps, runReplications(factory, len(reps), seeds, maxTicks, workers)...)
+
+		iv = analysis.MeanCI(reps.Values(metric), rule.Confidence)
+		if rule.Satisfied(iv) {
+			return reps, iv, true
+		}
+		if rule.Exhausted(iv) {
+			return reps, iv, false
+		}
+	}
+}
+
+// workers returns the number of worker goroutines to use.
+func (opts ReplicationOptions) workers() int {
+	if opts.Workers <= 0 {
+		return runtime.NumCPU()
+	}
+	return opts.Workers
+}
+
+// runReplications runs one replication for each of the given seeds, on up to
+// the given number of worker goroutines. The replications are numbered
+// starting at first.
+func runReplications(factory func(rep int) System, first int, seeds []int64, maxTicks int, workers int) Replications {
+	var reps Replications
+	var wg sync.WaitGroup
+	var ch chan int
+	var i, w int
+
+	reps = make(Replications, len(seeds))
+	ch = make(chan int)
+	for w = 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ch {
+				rep := first + i
+				sys := factory(rep)
+				reps[i] = ReplicationResult{
+					Rep:       rep,
+					Seed:      seeds[i],
+					Sys:       sys,
+					FinalTick: RunSimulation(sys, maxTicks, WithSeed(seeds[i])),
+				}
+			}
+		}()
+	}
+	for i = range seeds {
+		ch <- i
+	}
+	close(ch)
+	wg.Wait()
+
+	return reps
+}
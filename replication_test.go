@@ -0,0 +1,113 @@
+package qsim
+
+import (
+	"testing"
+
+	"github.com/danslimmon/qsim/analysis"
+)
+
+// Tests that RunReplications runs each replication and that the results
+// don't depend on the number of workers.
+func TestRunReplications(t *testing.T) {
+	t.Parallel()
+	var reps1, reps4 Replications
+	var i int
+
+	factory := func(rep int) System {
+		return &GrocerySystem{}
+	}
+	finished := func(sys System) float64 {
+		return float64(sys.(*GrocerySystem).Stats.Completed())
+	}
+	ticks := 3600 * 1000
+
+	reps1 = RunReplications(factory, 6, ticks, ReplicationOptions{Workers: 1, Seed: 7})
+	reps4 = RunReplications(factory, 6, ticks, ReplicationOptions{Workers: 4, Seed: 7})
+	if len(reps1) != 6 || len(reps4) != 6 {
+		t.Fatal("Expected 6 replications but got", len(reps1), "and", len(reps4))
+	}
+	for i = 0; i < 6; i++ {
+		if reps4[i].Rep != i {
+			t.Log("Replication", i, "has Rep", reps4[i].Rep)
+			t.Fail()
+		}
+		if reps4[i].FinalTick < ticks {
+			t.Log("Replication", i, "stopped early at tick", reps4[i].FinalTick)
+			t.Fail()
+		}
+		if finished(reps1[i].Sys) != finished(reps4[i].Sys) || reps1[i].Seed != reps4[i].Seed {
+			t.Log("Replication", i, "came out differently with a different number of workers")
+			t.Fail()
+		}
+	}
+	if reps4[0].Seed == reps4[1].Seed {
+		t.Log("Replications were given the same seed")
+		t.Fail()
+	}
+	if reps4.Sum(finished) != 6*reps4.Mean(finished) {
+		t.Log("Sum and Mean of replication results don't agree")
+		t.Fail()
+	}
+}
+
+// Tests the element-by-element aggregation helpers.
+func TestReplicationsSumInts(t *testing.T) {
+	t.Parallel()
+	var reps Replications
+	var sums []int
+
+	reps = Replications{
+		{Rep: 0, Sys: &timerSystem{EventTicks: []int{0, 100, 200}}},
+		{Rep: 1, Sys: &timerSystem{EventTicks: []int{0, 100, 200, 300}}},
+	}
+	if reps.SumInt(func(sys System) int { return len(sys.(*timerSystem).EventTicks) }) != 7 {
+		t.Log("SumInt gave the wrong answer")
+		t.Fail()
+	}
+	sums = reps.SumInts(func(sys System) []int {
+		n := len(sys.(*timerSystem).EventTicks)
+		return []int{n, 2 * n, n - 3}
+	})
+	if len(sums) != 3 || sums[0] != 7 || sums[1] != 14 || sums[2] != 1 {
+		t.Log("Expected SumInts to give [7 14 1] but got", sums)
+		t.Fail()
+	}
+}
+
+// Tests that RunReplicationsUntil stops once the interval is narrow enough,
+// and that its replications match the ones RunReplications would run.
+func TestRunReplicationsUntil(t *testing.T) {
+	t.Parallel()
+	var reps, fixed Replications
+	var iv analysis.Interval
+	var rule analysis.StoppingRule
+	var ok bool
+
+	factory := func(rep int) System {
+		return &GrocerySystem{}
+	}
+	avgTime := func(sys System) float64 {
+		sojourns := sys.(*GrocerySystem).Stats.Sojourns()
+		return sojourns.Mean()
+	}
+	ticks := 3600 * 1000
+	opts := ReplicationOptions{Workers: 3, Seed: 11}
+
+	rule = analysis.StoppingRule{HalfWidth: 0.1, Relative: true, Confidence: 0.95, MinN: 4, MaxN: 60}
+	reps, iv, ok = RunReplicationsUntil(factory, ticks, avgTime, rule, opts)
+	if !ok {
+		t.Fatal("Expected to reach 10% precision within 60 replications; got", iv)
+	}
+	if iv.N != len(reps) || len(reps) < 4 || len(reps)%3 == 2 {
+		t.Log("Unexpected number of replications:", len(reps))
+		t.Fail()
+	}
+
+	fixed = RunReplications(factory, len(reps), ticks, opts)
+	for i := range reps {
+		if reps[i].Rep != i || reps[i].Seed != fixed[i].Seed || avgTime(reps[i].Sys) != avgTime(fixed[i].Sys) {
+			t.Log("Replication", i, "differs from the one RunReplications ran")
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package qsim
+
+import (
+	"math/rand"
+
+	"github.com/danslimmon/qsim/analysis"
+)
+
+// A Destination is where a Router sends a Job after a Processor finishes
+// it. If ArrBeh is set, the Job is handed to it with Assign, just as though
+// it had arrived from outside; otherwise, if Queue is set, the Job is
+// appended to Queue. The zero Destination means the Job leaves the system.
+type Destination struct {
+	Queue  *Queue
+	ArrBeh ArrBeh
+}
+
+// IsExit returns true if d sends Jobs out of the system.
+func (d Destination) IsExit() bool {
+	return d.Queue == nil && d.ArrBeh == nil
+}
+
+// A Routing decides where a Job goes after it finishes on a Processor.
+type Routing interface {
+	// Route returns the Destination for j, which p has just finished.
+	Route(p *Processor, j *Job) Destination
+}
+
+// RoutingFunc lets an ordinary function be used as a Routing. This is the
+// way to route Jobs by their attributes: a Job whose StrAttrs["tests"] is
+// "skip" might go straight from the build station to the deploy station,
+// say. j.Visits tells you where the Job has already been.
+type RoutingFunc func(p *Processor, j *Job) Destination
+
+// Route calls f(p, j).
+func (f RoutingFunc) Route(p *Processor, j *Job) Destination {
+	return f(p, j)
+}
+
+// FixedRouting sends every Job finished by a Processor to the same
+// Destination, like a pipeline whose build station always feeds its test
+// station. Jobs finished by Processors that aren't in the map leave the
+// system.
+type FixedRouting map[*Processor]Destination
+
+// Route returns the Destination for p.
+func (fr FixedRouting) Route(p *Processor, j *Job) Destination {
+	return fr[p]
+}
+
+// A Branch is one of the ways out of a station in a ProbabilisticRouting.
+type Branch struct {
+	// Prob is the probability that a Job takes this Branch.
+	Prob float64
+	To   Destination
+}
+
+// ProbabilisticRouting picks each Job's next Destination at random, as in a
+// Jackson network. Matrix gives the Branches out of each Processor; if
+// their probabilities add up to less than 1, the rest is the probability
+// that the Job leaves the system. Jobs finished by Processors that aren't
+// in Matrix leave the system.
+type ProbabilisticRouting struct {
+	Matrix map[*Processor][]Branch
+	// Rand is used to pick Branches. If Rand is nil, ProbabilisticRouting
+	// draws from the Rand of the Simulation that the Job belongs to.
+	Rand *rand.Rand
+}
+
+// Route picks one of the Branches out of p at random.
+func (pr *ProbabilisticRouting) Route(p *Processor, j *Job) Destination {
+	var r *rand.Rand
+	var b Branch
+	var x float64
+	r = pr.Rand
+	if r == nil && j.sim != nil {
+		r = j.sim.Rand
+	}
+	x = randFloat64(r)
+	for _, b = range pr.Matrix[p] {
+		if x < b.Prob {
+			return b.To
+		}
+		x -= b.Prob
+	}
+	return Destination{}
+}
+
+// A Router connects Processors into a network of stations. Whenever one of
+// its Processors finishes a Job, the Router asks its Routing where the Job
+// should go next and sends it there, keeping a record of the visit in
+// j.Visits. Create one with NewRouter.
+//
+// The Router forwards a Job only after all of the Processor's AfterFinish
+// callbacks have run, so stats collectors see each visit as it was. Once a
+// Job has been forwarded, its SojournTime covers only its time at the new
+// station; the Router keeps track of the Jobs' whole trips through the
+// system.
+//
+// Nothing that happens before the WarmUp tick is counted in the Router's
+// statistics.
+type Router struct {
+	// Routing decides where each Job goes.
+	Routing Routing
+	// Processors are the Processors the Router forwards Jobs from. When a
+	// Job is sent straight to a Queue, idle Processors among these are
+	// asked to Pull, in case one of them serves that Queue.
+	Processors []*Processor
+	// WarmUp is the tick at which collection begins.
+	WarmUp int
+	// Departed is the number of Jobs that have left the system.
+	Departed int
+	// Sojourns holds the time each departed Job spent in the system, from
+	// its arrival at the first station to its departure from the last.
+	// SojournQuantiles holds the same observations, for estimating
+	// percentiles.
+	Sojourns         analysis.Tally
+	SojournQuantiles analysis.Sketch
+	// Visits holds the number of stations each departed Job visited.
+	Visits analysis.Tally
+
+	sim *Simulation
+	// Callback lists
+	cbBeforeRoute []func(r *Router, j *Job, dest Destination)
+	cbAfterRoute  []func(r *Router, j *Job, dest Destination)
+}
+
+// route sends j, which p has just finished, on to its next Destination.
+func (r *Router) route(p *Processor, j *Job) {
+	var dest Destination
+	dest = r.Routing.Route(p, j)
+	r.beforeRoute(j, dest)
+	if dest.IsExit() {
+		j.Visits = append(j.Visits, j.visit())
+		D("Job", j.JobId, "left the system after", len(j.Visits), "visits")
+		if r.sim.clock >= r.WarmUp {
+			r.Departed++
+			r.Sojourns.Add(float64(j.SystemTime()))
+			r.SojournQuantiles.Add(float64(j.SystemTime()))
+			r.Visits.Add(float64(len(j.Visits)))
+		}
+		r.afterRoute(j, dest)
+		return
+	}
+
+	j.forward()
+	D("Job", j.JobId, "was routed onward")
+	send(r.sim, j, dest, r.Processors)
+	r.afterRoute(j, dest)
+}
+
+// send delivers j to dest. If dest is a Queue, the idle Processors among
+// procs are asked to Pull afterward.
+func send(sim *Simulation, j *Job, dest Destination, procs []*Processor) {
+	if dest.ArrBeh != nil {
+		// The Simulation only knows about the System's own ArrBeh, so
+		// make sure this one draws from the Simulation's Rand too.
+		sim.bind(dest.ArrBeh)
+		dest.ArrBeh.Assign(j)
+	} else if dest.Queue != nil {
+		dest.Queue.Append(j)
+		pullIdle(procs)
+	}
+}
+
+// BeforeRoute adds a callback to be run immediately before a Job is sent
+// to its next Destination.
+//
+// The callback will be passed the Router itself, the Job, and the
+// Destination it's about to be sent to. If the Job is about to leave the
+// system, the Destination is the zero Destination.
+func (r *Router) BeforeRoute(f func(r *Router, j *Job, dest Destination)) {
+	r.cbBeforeRoute = append(r.cbBeforeRoute, f)
+}
+func (r *Router) beforeRoute(j *Job, dest Destination) {
+	for _, cb := range r.cbBeforeRoute {
+		cb(r, j, dest)
+	}
+}
+
+// AfterRoute adds a callback to be run immediately after a Job has been
+// sent to its next Destination.
+//
+// The callback will be passed the Router itself, the Job, and the
+// Destination it was sent to. If the Job left the system, the Destination
+// is the zero Destination, and the Job's last visit is at the end of
+// j.Visits.
+func (r *Router) AfterRoute(f func(r *Router, j *Job, dest Destination)) {
+	r.cbAfterRoute = append(r.cbAfterRoute, f)
+}
+func (r *Router) afterRoute(j *Job, dest Destination) {
+	for _, cb := range r.cbAfterRoute {
+		cb(r, j, dest)
+	}
+}
+
+// NewRouter starts forwarding the Jobs finished by procs in sim according
+// to routing, ignoring everything that happens before warmUp in its
+// statistics.
+func NewRouter(sim *Simulation, procs []*Processor, routing Routing, warmUp int) *Router {
+	var r *Router
+	var p *Processor
+
+	r = &Router{Routing: routing, Processors: procs, WarmUp: warmUp, sim: sim}
+	for _, p = range procs {
+		p.departHooks = append(p.departHooks, r.route)
+	}
+	return r
+}
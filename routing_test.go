@@ -0,0 +1,157 @@
+package qsim
+
+import (
+	"math"
+	"testing"
+)
+
+// newStation creates a Queue served by a single Processor that takes
+// procTime ticks per Job.
+func newStation(procTime int) (*Queue, *Processor) {
+	var q *Queue
+	var p *Processor
+	q = NewQueue()
+	p = NewProcessor(func(j *Job) int { return procTime })
+	NewSharedQueueDiscipline(q, []*Processor{p})
+	return q, p
+}
+
+// Tests a build → test → deploy pipeline with a FixedRouting, including the
+// Jobs' visit histories and end-to-end sojourn times.
+func TestRouterFixedRouting(t *testing.T) {
+	t.Parallel()
+	var sys *funcSystem
+	var r *Router
+	var departed []*Job
+	var build, test, deploy *Processor
+	var testQ, deployQ *Queue
+	var buildStats *ProcessorStats
+
+	sys = &funcSystem{InitFunc: func(sys *funcSystem) {
+		var buildQ *Queue
+		buildQ, build = newStation(10)
+		testQ, test = newStation(20)
+		deployQ, deploy = newStation(5)
+		sys.Procs = []*Processor{build, test, deploy}
+		sys.AP = NewConstantArrProc(100)
+		sys.AB = NewAlwaysQueueArrBeh(buildQ, sys.AP)
+		sys.AB.(*AlwaysQueueArrBeh).Processors = sys.Procs
+		buildStats = NewProcessorStats(sys.Sim, build, 0)
+		r = NewRouter(sys.Sim, sys.Procs, FixedRouting{
+			build: {Queue: testQ},
+			test:  {Queue: deployQ},
+		}, 0)
+		r.AfterRoute(func(r *Router, j *Job, dest Destination) {
+			if dest.IsExit() {
+				departed = append(departed, j)
+			}
+		})
+	}}
+	RunSimulation(sys, 1000, WithSeed(1))
+
+	if len(departed) != 10 || r.Departed != 10 {
+		t.Fatal("Expected 10 Jobs to make it through the pipeline but", r.Departed, "did")
+	}
+	for _, j := range departed {
+		if len(j.Visits) != 3 || j.Visits[0].Processor != build || j.Visits[1].Processor != test || j.Visits[2].Processor != deploy {
+			t.Log("Job", j.JobId, "didn't visit build, test, and deploy in order")
+			t.Fail()
+			continue
+		}
+		if j.Visits[1].Queue != testQ || j.Visits[1].ArrTime != j.ArrTime+10 || j.Visits[2].StartTime != j.ArrTime+30 {
+			t.Log("Job", j.JobId, "has the wrong visit history:", j.Visits)
+			t.Fail()
+		}
+		if j.SystemTime() != 35 || j.SojournTime() != 5 {
+			t.Log("Expected Job to spend 35 ticks in the system and 5 at the deploy station but got", j.SystemTime(), "and", j.SojournTime())
+			t.Fail()
+		}
+	}
+	if r.Sojourns.Mean() != 35 || r.Visits.Mean() != 3 {
+		t.Log("Expected mean sojourn 35 over 3 visits but got", r.Sojourns.Mean(), "over", r.Visits.Mean())
+		t.Fail()
+	}
+	if buildStats.Sojourns.Mean() != 10 {
+		t.Log("The build station's stats should only count the build visit, but got mean sojourn", buildStats.Sojourns.Mean())
+		t.Fail()
+	}
+}
+
+// Tests a single-station Jackson network in which Jobs go around again with
+// probability 1/2, so that they make 2 visits on average.
+func TestRouterProbabilisticRouting(t *testing.T) {
+	t.Parallel()
+	var sys *funcSystem
+	var r *Router
+
+	sys = &funcSystem{InitFunc: func(sys *funcSystem) {
+		q, p := newStation(1)
+		sys.Procs = []*Processor{p}
+		sys.AP = NewConstantArrProc(10)
+		sys.AB = NewSharedQueueArrBeh(q, sys.Procs, sys.AP)
+		r = NewRouter(sys.Sim, sys.Procs, &ProbabilisticRouting{
+			Matrix: map[*Processor][]Branch{
+				p: {{Prob: 0.5, To: Destination{Queue: q}}},
+			},
+		}, 0)
+	}}
+	RunSimulation(sys, 200000, WithSeed(1))
+
+	if r.Departed < 19000 || math.Abs(r.Visits.Mean()-2) > 0.05 {
+		t.Log("Expected Jobs to make 2 visits on average but they made", r.Visits.Mean())
+		t.Fail()
+	}
+}
+
+// Tests routing by Job attributes with a RoutingFunc, and sending Jobs to an
+// ArrBeh instead of straight to a Queue.
+func TestRouterRoutingFunc(t *testing.T) {
+	t.Parallel()
+	var sys *funcSystem
+	var r *Router
+	var skipped, tested int
+
+	sys = &funcSystem{InitFunc: func(sys *funcSystem) {
+		buildQ, build := newStation(10)
+		testQ, test := newStation(20)
+		deployQ, deploy := newStation(5)
+		sys.Procs = []*Processor{build, test, deploy}
+		sys.AP = NewConstantArrProc(100)
+		sys.AP.AfterArrive(func(ap ArrProc, jobs []*Job, interval int) {
+			for _, j := range jobs {
+				if sys.Sim.Clock()%200 == 0 {
+					j.StrAttrs["tests"] = "skip"
+				}
+			}
+		})
+		sys.AB = NewSharedQueueArrBeh(buildQ, []*Processor{build}, sys.AP)
+		deployAB := NewSharedQueueArrBeh(deployQ, []*Processor{deploy}, nil)
+		r = NewRouter(sys.Sim, sys.Procs, RoutingFunc(func(p *Processor, j *Job) Destination {
+			switch {
+			case p == build && j.StrAttrs["tests"] == "skip":
+				return Destination{ArrBeh: deployAB}
+			case p == build:
+				return Destination{Queue: testQ}
+			case p == test:
+				return Destination{ArrBeh: deployAB}
+			}
+			return Destination{}
+		}), 0)
+		r.AfterRoute(func(r *Router, j *Job, dest Destination) {
+			if !dest.IsExit() {
+				return
+			}
+			if len(j.Visits) == 2 {
+				skipped++
+			} else {
+				tested++
+			}
+		})
+	}}
+	RunSimulation(sys, 999, WithSeed(1))
+
+	if skipped != 5 || tested != 5 {
+		t.Log("Expected 5 Jobs to skip the tests and 5 to run them but got", skipped, "and", tested)
+		t.Fail()
+	}
+}
@@ -0,0 +1,29 @@
+package qsim
+
+// A Setup decides how long a Processor needs to get ready for a Job of one
+// Class after serving a Job of another. See Processor.Setup.
+type Setup interface {
+	// SetupTime returns the number of ticks it takes to switch from Jobs
+	// of Class from to Jobs of Class to. from is "" if the Processor
+	// hasn't started any Jobs yet.
+	SetupTime(from, to string) int
+}
+
+// SetupFunc lets an ordinary function be used as a Setup. This is the way
+// to draw setup times at random.
+type SetupFunc func(from, to string) int
+
+// SetupTime calls f(from, to).
+func (f SetupFunc) SetupTime(from, to string) int {
+	return f(from, to)
+}
+
+// SetupMatrix gives a fixed setup time for each change of Class:
+// SetupMatrix[from][to]. Changes that aren't in the matrix, including
+// staying with the same Class, take no time.
+type SetupMatrix map[string]map[string]int
+
+// SetupTime looks up the setup time in the matrix.
+func (m SetupMatrix) SetupTime(from, to string) int {
+	return m[from][to]
+}
@@ -0,0 +1,68 @@
+package qsim
+
+import (
+	"testing"
+)
+
+// setupSystem has a single 10-tick Processor with arrivals every 12 ticks,
+// alternating between two Classes, and a 5-tick setup between Classes. If
+// Batching is set, the Processor uses a ClassBatchingDiscipline.
+type setupSystem struct {
+	funcSystem
+	Batching bool
+
+	Stats *ProcessorStats
+}
+
+func (sys *setupSystem) Init() {
+	var q *Queue
+	var p *Processor
+	var n int
+	q = NewQueue()
+	p = NewProcessor(func(j *Job) int { return 10 })
+	p.Setup = SetupFunc(func(from, to string) int {
+		if from == to {
+			return 0
+		}
+		return 5
+	})
+	if sys.Batching {
+		NewClassBatchingDiscipline(q, []*Processor{p})
+	} else {
+		NewSharedQueueDiscipline(q, []*Processor{p})
+	}
+	sys.Procs = []*Processor{p}
+	sys.AP = NewConstantArrProc(12)
+	sys.AP.BeforeArrive(func(ap ArrProc) { n++ })
+	sys.AB = NewSharedQueueArrBeh(q, sys.Procs, sys.AP)
+	sys.AB.BeforeAssign(func(ab ArrBeh, j *Job) *Assignment {
+		j.Class = []string{"a", "b"}[n%2]
+		return nil
+	})
+	sys.Stats = NewProcessorStats(sys.Sim, p, 0)
+}
+
+// Tests that setup times are counted in ProcessorStats, and that batching
+// Jobs by Class cuts down on them.
+func TestClassBatchingSetups(t *testing.T) {
+	t.Parallel()
+	var fifoSys, batchedSys *setupSystem
+	var fifo, batched *ProcessorStats
+
+	fifoSys = &setupSystem{}
+	RunSimulation(fifoSys, 10000, WithSeed(1))
+	fifo = fifoSys.Stats
+	batchedSys = &setupSystem{Batching: true}
+	RunSimulation(batchedSys, 10000, WithSeed(1))
+	batched = batchedSys.Stats
+
+	if fifo.Setups.Count() < fifo.Completed-1 || fifo.Setups.Mean() != 5 {
+		t.Log("Expected a setup for nearly every Job without batching but got", fifo.Setups.Count(), "for", fifo.Completed, "Jobs")
+		t.Fail()
+	}
+	if 3*batched.Setups.Count() > 2*fifo.Setups.Count() || batched.Completed <= fifo.Completed {
+		t.Log("Expected batching to cut the number of setups by at least a third and finish more Jobs but got",
+			batched.Setups.Count(), "setups and", batched.Completed, "Jobs")
+		t.Fail()
+	}
+}
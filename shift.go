@@ -0,0 +1,103 @@
+package qsim
+
+// A ShiftChange is a change in a Processor's staffing.
+type ShiftChange struct {
+	// Tick is when the change happens. If the Shifts repeat, it's counted
+	// from the start of each period.
+	Tick int
+	// Capacity is the number of Jobs the Processor can work on from Tick
+	// on. A Capacity of 0 closes the Processor.
+	Capacity int
+}
+
+// Shifts opens, closes, and resizes a Processor according to a calendar:
+// a support team whose headcount changes with the hour of the day, say.
+// Create one with NewShifts.
+//
+// When a ShiftChange lowers the Processor's Capacity or closes it, the
+// Shifts' Mode says what becomes of the Jobs in service; see CloseMode. Any
+// Jobs evicted by a hard close are put back at the head of Queue. A closed
+// Processor is never idle, so an ArrBeh like ShortestQueueArrBeh never
+// sends it arrivals. To find out how much of the time the Processor was
+// staffed, use ProcessorStats.
+type Shifts struct {
+	// The Processor being staffed.
+	Processor *Processor
+	// Changes are the ShiftChanges, in order of Tick.
+	Changes []ShiftChange
+	// Period, if it's positive, makes the Changes repeat every Period
+	// ticks: with one tick per minute, a Period of 1440 gives a daily
+	// calendar. Otherwise each ShiftChange happens once.
+	Period int
+	// Mode says what becomes of the Jobs in service when the Processor
+	// loses slots. The default is CloseGraceful.
+	Mode CloseMode
+	// Queue is where Jobs evicted by a hard close are put. If Queue is
+	// nil, they're dropped.
+	Queue *Queue
+
+	sim *Simulation
+	// The index of the next ShiftChange, the start of the period it's in,
+	// and the event that will make it happen.
+	i     int
+	start int
+	next  *EventHandle
+}
+
+// scheduleChange arranges for the next ShiftChange that hasn't happened
+// yet.
+func (s *Shifts) scheduleChange() {
+	s.next = nil
+	for {
+		if s.i == len(s.Changes) {
+			if s.Period <= 0 || len(s.Changes) == 0 {
+				return
+			}
+			s.i = 0
+			s.start += s.Period
+		}
+		if s.start+s.Changes[s.i].Tick >= s.sim.clock {
+			break
+		}
+		s.i++
+	}
+	s.next = s.sim.ScheduleAt(s.start+s.Changes[s.i].Tick, func(clock int) {
+		s.apply(s.Changes[s.i])
+		s.i++
+		s.scheduleChange()
+	})
+}
+
+// apply makes the Processor's staffing match c.
+func (s *Shifts) apply(c ShiftChange) {
+	var p *Processor
+	p = s.Processor
+	if c.Capacity <= 0 {
+		p.Close(s.Mode, s.Queue)
+		return
+	}
+	if c.Capacity != p.Capacity {
+		p.Resize(c.Capacity, s.Mode, s.Queue)
+	}
+	p.Open()
+}
+
+// Stop calls off the Processor's remaining ShiftChanges. The Processor is
+// left staffed as it is.
+func (s *Shifts) Stop() {
+	if s.next != nil {
+		s.next.Cancel()
+		s.next = nil
+	}
+}
+
+// NewShifts starts staffing p in sim according to changes, repeating them
+// every period ticks if period is positive. ShiftChanges whose time has
+// already passed are skipped.
+func NewShifts(sim *Simulation, p *Processor, changes []ShiftChange, period int) *Shifts {
+	var s *Shifts
+
+	s = &Shifts{Processor: p, Changes: changes, Period: period, sim: sim}
+	s.scheduleChange()
+	return s
+}
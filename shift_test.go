@@ -0,0 +1,102 @@
+package qsim
+
+import (
+	"testing"
+)
+
+// shiftSystem has two 15-tick Processors sharing a Queue, with arrivals
+// every 10 ticks. The second Processor is only staffed for the second half
+// of every 1000 ticks.
+type shiftSystem struct {
+	funcSystem
+	Mode CloseMode
+
+	Shifts *Shifts
+	Stats  *ProcessorStats
+	// Whether a Job was ever started on the second Processor, or left
+	// waiting for it, while it was closed.
+	StartedWhileClosed bool
+}
+
+func (sys *shiftSystem) Init() {
+	var q *Queue
+	var p *Processor
+	var sqab *ShortestQueueArrBeh
+	q = NewQueue()
+	sys.Procs = []*Processor{
+		NewProcessor(func(j *Job) int { return 15 }),
+		NewProcessor(func(j *Job) int { return 15 }),
+	}
+	NewSharedQueueDiscipline(q, sys.Procs)
+	sys.AP = NewConstantArrProc(10)
+	sys.AB = NewSharedQueueArrBeh(q, sys.Procs, sys.AP)
+	sqab = sys.AB.(*ShortestQueueArrBeh)
+	p = sys.Procs[1]
+	p.AfterStart(func(p *Processor, j *Job, procTime int) {
+		if j != nil && p.IsClosed() {
+			sys.StartedWhileClosed = true
+		}
+	})
+	p.AfterClose(func(p *Processor, evicted []*Job) {
+		if sqab.IdleProcessors[p] {
+			sys.StartedWhileClosed = true
+		}
+	})
+	sys.Stats = NewProcessorStats(sys.Sim, p, 0)
+	sys.Shifts = NewShifts(sys.Sim, p, []ShiftChange{{0, 0}, {500, 1}}, 1000)
+	sys.Shifts.Mode = sys.Mode
+	sys.Shifts.Queue = q
+}
+
+// Tests that a Processor on a schedule gets Jobs only while it's open.
+func TestShifts(t *testing.T) {
+	t.Parallel()
+	var sys *shiftSystem
+	var ps *ProcessorStats
+
+	sys = &shiftSystem{Mode: CloseGraceful}
+	RunSimulation(sys, 9999, WithSeed(1))
+	ps = sys.Stats
+
+	if sys.StartedWhileClosed {
+		t.Log("A Job was started on the Processor while it was closed")
+		t.Fail()
+	}
+	if ps.StaffedTime() < 5000 || ps.StaffedTime() > 5000+10*15 {
+		t.Log("Expected the Processor to be staffed for about 5000 ticks but got", ps.StaffedTime())
+		t.Fail()
+	}
+	if ps.Completed < 300 || ps.Evicted != 0 {
+		t.Log("Expected the Processor to finish Jobs during its shifts and evict none but got", ps.Completed, "and", ps.Evicted)
+		t.Fail()
+	}
+}
+
+// Tests that a hard close evicts the Jobs in service and puts them back in
+// the Queue, and that Stop leaves the Processor as it is.
+func TestShiftsHard(t *testing.T) {
+	t.Parallel()
+	var sys *shiftSystem
+	var sim *Simulation
+	var ps *ProcessorStats
+
+	sys = &shiftSystem{Mode: CloseHard}
+	sim = NewSimulation(sys, WithSeed(1))
+	sim.Run(9900)
+	ps = sys.Stats
+
+	if sys.StartedWhileClosed {
+		t.Log("A Job was started on the Processor while it was closed")
+		t.Fail()
+	}
+	if ps.StaffedTime() != 4500+sim.Clock()-9500 || ps.Evicted != 8 {
+		t.Log("Expected", 4500+sim.Clock()-9500, "staffed ticks and 8 evictions but got", ps.StaffedTime(), "and", ps.Evicted)
+		t.Fail()
+	}
+	sys.Shifts.Stop()
+	sim.Run(20000)
+	if sys.Shifts.Processor.IsClosed() || ps.Evicted != 8 {
+		t.Log("Expected the Processor to be left open once the Shifts were stopped")
+		t.Fail()
+	}
+}
@@ -1,5 +1,13 @@
 package qsim
 
+import (
+	"container/heap"
+	"math/rand"
+	"time"
+
+	"github.com/danslimmon/qsim/analysis"
+)
+
 // An event scheduled to occur in the simulation We'll run the function F at
 // tick Time. F will be called at time Time with the current clock time as its
 // argument.
@@ -10,62 +18,150 @@ type simEvent struct {
 
 // Schedule holds simEvents in the order that they need to be run. Events that
 // have already occurred are removed.
+//
+// Internally the Schedule is a binary heap, so adding an event takes
+// O(log n) time no matter how many events are pending. Events scheduled for
+// the same tick are run in the order in which they were added.
 type Schedule struct {
-	// The list of events that have yet to occur. This is kept in ascending time
-	// order.
-	events []simEvent
+	// The heap of events that have yet to occur.
+	events eventHeap
+	// The number of events that have ever been added. Each event is stamped
+	// with this value so that events at the same tick keep their FIFO order.
+	seq uint64
 }
 
-// Add puts a new event in the schedule.
-func (sch *Schedule) Add(newEv simEvent) {
-	var i int
-	D("Added event for time", newEv.T)
+// scheduledEvent is a simEvent sitting in a Schedule.
+type scheduledEvent struct {
+	ev  simEvent
+	seq uint64
+	// The position of the event in the heap.
+	index int
+}
 
-	if len(sch.events) == 0 {
-		sch.events = append(sch.events, newEv)
-		return
-	}
+// eventHeap implements heap.Interface for scheduledEvents, ordering them by
+// time and then by the order in which they were added.
+type eventHeap []*scheduledEvent
 
-	for i = len(sch.events) - 1; i >= 0; i-- {
-		if sch.events[i].T <= newEv.T {
-			sch.insertEvent(i+1, newEv)
-			return
-		}
+func (h eventHeap) Len() int { return len(h) }
+func (h eventHeap) Less(i, j int) bool {
+	if h[i].ev.T != h[j].ev.T {
+		return h[i].ev.T < h[j].ev.T
 	}
-	// Fell off the beginning of the schedule, so just insert at the beginning
-	sch.insertEvent(0, newEv)
-	return
+	return h[i].seq < h[j].seq
+}
+func (h eventHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *eventHeap) Push(x interface{}) {
+	se := x.(*scheduledEvent)
+	se.index = len(*h)
+	*h = append(*h, se)
+}
+func (h *eventHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	se := old[n-1]
+	old[n-1] = nil
+	se.index = -1
+	*h = old[:n-1]
+	return se
+}
+
+// Add puts a new event in the schedule.
+//
+// The returned EventHandle can be used to cancel or reschedule the event
+// before it occurs.
+func (sch *Schedule) Add(newEv simEvent) *EventHandle {
+	var se *scheduledEvent
+	D("Added event for time", newEv.T)
+	sch.seq++
+	se = &scheduledEvent{ev: newEv, seq: sch.seq}
+	heap.Push(&sch.events, se)
+	return &EventHandle{sch: sch, se: se}
+}
+
+// Len returns the number of events that have yet to occur.
+func (sch *Schedule) Len() int {
+	return len(sch.events)
 }
 
 // Next returns the events in the schedule that are next to occur and removes
 // those events from the schedule. It also returns the tick at which those
 // events occur.
 func (sch *Schedule) NextTick() (events []simEvent, tick int) {
-	var i int
+	var se *scheduledEvent
 
 	// This should never happen, which means it definitely will some day.
 	if len(sch.events) == 0 {
 		panic("next Schedule event requested but Schedule is empty")
 	}
 
-	events = append(events, sch.events[0])
-	for i = 1; i < len(sch.events); i++ {
-		if sch.events[i].T == events[0].T {
-			events = append(events, sch.events[i])
-		} else {
-			break
-		}
+	tick = sch.events[0].ev.T
+	for len(sch.events) > 0 && sch.events[0].ev.T == tick {
+		se = heap.Pop(&sch.events).(*scheduledEvent)
+		events = append(events, se.ev)
+	}
+	return events, tick
+}
+
+// pop removes the next event from the schedule and returns it, provided that
+// it occurs at the given tick. Otherwise ok is false.
+func (sch *Schedule) pop(tick int) (ev simEvent, ok bool) {
+	var se *scheduledEvent
+	if len(sch.events) == 0 || sch.events[0].ev.T != tick {
+		return ev, false
+	}
+	se = heap.Pop(&sch.events).(*scheduledEvent)
+	return se.ev, true
+}
+
+// An EventHandle refers to an event that has been added to a Schedule.
+type EventHandle struct {
+	sch *Schedule
+	se  *scheduledEvent
+}
+
+// Pending returns true if the event has yet to occur and hasn't been
+// canceled.
+func (h *EventHandle) Pending() bool {
+	return h.se.index >= 0
+}
+
+// Time returns the tick at which the event is (or was) scheduled to occur.
+func (h *EventHandle) Time() int {
+	return h.se.ev.T
+}
+
+// Cancel removes the event from the Schedule so that it will never occur.
+//
+// The return value indicates whether the event was still pending. Canceling
+// an event that has already occurred or been canceled does nothing.
+func (h *EventHandle) Cancel() bool {
+	if !h.Pending() {
+		return false
 	}
-	sch.events = sch.events[i:]
-	return events, events[0].T
+	D("Canceled event for time", h.se.ev.T)
+	heap.Remove(&h.sch.events, h.se.index)
+	return true
 }
 
-// insertEvent places a simEvent at the given index in sch.events.
-func (sch *Schedule) insertEvent(idx int, newEv simEvent) {
-	sch.events = append(sch.events, simEvent{})
-	copy(sch.events[idx+1:], sch.events[idx:])
-	sch.events[idx] = newEv
-	return
+// Reschedule moves the event to tick t. If the event has already occurred or
+// been canceled, it's put back in the Schedule.
+//
+// A rescheduled event runs after any events that were already scheduled for
+// tick t.
+func (h *EventHandle) Reschedule(t int) {
+	D("Rescheduled event from time", h.se.ev.T, "to", t)
+	h.sch.seq++
+	h.se.ev.T = t
+	h.se.seq = h.sch.seq
+	if h.Pending() {
+		heap.Fix(&h.sch.events, h.se.index)
+	} else {
+		heap.Push(&h.sch.events, h.se)
+	}
 }
 
 // NewSchedule creates a new, empty Schedule struct.
@@ -86,8 +182,9 @@ type System interface {
 	// BeforeTick is called right before the clock starts on a simulation.
 	BeforeFirstTick()
 	// BeforeEvents runs at every tick when a simulation event happens (a
-	// Job arrives in the system, or a Job finishes processing and leaves
-	// the system). BeforeEvents is called after all the events for the tick
+	// Job arrives in the system, a Job finishes processing and leaves
+	// the system, or an event scheduled with Simulation.ScheduleAt
+	// occurs). BeforeEvents is called after all the events for the tick
 	// in question have finished.
 	BeforeEvents(clock int)
 	// AfterEvents runs at every tick when a simulation event happens, but
@@ -98,7 +195,93 @@ type System interface {
 	Processors() []*Processor
 }
 
-// RunSimulation simulates a queueing system for a certain number of ticks.
+// SimulationAware may be implemented by a System that needs access to the
+// Simulation that's running it; for example, to schedule its own events
+// with ScheduleAt. If the System implements SimulationAware, SetSimulation
+// is called right before Init.
+type SimulationAware interface {
+	SetSimulation(sim *Simulation)
+}
+
+// A Simulation runs a System, keeping track of the clock and the Schedule of
+// upcoming events.
+//
+// Most of the time you'll just call RunSimulation, which creates a
+// Simulation for you. But you can also create one yourself (or implement
+// SimulationAware) in order to schedule events of your own.
+type Simulation struct {
+	// Sys is the System being simulated.
+	Sys System
+	// Rand is the Simulation's source of random numbers. Built-in
+	// components that need randomness (like PoissonArrProc and
+	// ShortestQueueArrBeh) draw from Rand unless they've been given a
+	// *rand.Rand of their own. If your System draws random numbers too, it
+	// should use Rand as well; then two runs with the same seed will be
+	// identical.
+	Rand *rand.Rand
+
+	sch     *Schedule
+	clock   int
+	started bool
+	// Pending finish events for each Job in service.
+	finishEvents map[*Job]*EventHandle
+}
+
+// An Option changes the way a Simulation is set up. Options are passed to
+// NewSimulation or RunSimulation.
+type Option func(sim *Simulation)
+
+// WithSeed seeds the Simulation's Rand with the given value. Without this
+// Option, Rand is seeded with the current time.
+func WithSeed(seed int64) Option {
+	return func(sim *Simulation) {
+		sim.Rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// WithRand makes the Simulation draw its random numbers from r.
+func WithRand(r *rand.Rand) Option {
+	return func(sim *Simulation) {
+		sim.Rand = r
+	}
+}
+
+// Clock returns the current simulation clock time.
+func (sim *Simulation) Clock() int {
+	return sim.clock
+}
+
+// NewJob creates a new Job that arrives at the current clock time. Its
+// JobId is drawn from the Simulation's Rand, and its timestamps will be
+// recorded as it passes through Queues and Processors.
+func (sim *Simulation) NewJob() *Job {
+	return newJob(sim.clock, sim.Rand, sim)
+}
+
+// ScheduleAt arranges for f to be called at the given tick. f will be passed
+// the current clock time.
+//
+// Events scheduled with ScheduleAt run alongside the Simulation's own
+// arrival and finish events, so System.BeforeEvents and System.AfterEvents
+// will be called around them. Events that share a tick run in the order in
+// which they were scheduled.
+//
+// The returned EventHandle may be used to cancel or reschedule the event.
+// ScheduleAt panics if tick is earlier than the current clock time.
+func (sim *Simulation) ScheduleAt(tick int, f func(clock int)) *EventHandle {
+	if tick < sim.clock {
+		panic("event scheduled for a tick that has already passed")
+	}
+	return sim.sch.Add(simEvent{tick, f})
+}
+
+// ScheduleAfter arranges for f to be called once delay ticks have elapsed. It
+// works just like ScheduleAt otherwise.
+func (sim *Simulation) ScheduleAfter(delay int, f func(clock int)) *EventHandle {
+	return sim.ScheduleAt(sim.clock+delay, f)
+}
+
+// Run simulates the System for a certain number of ticks.
 //
 // The internal operations of a queuing system take care of themselves, so
 // this function is only responsible for things going into and out of the
@@ -107,52 +290,190 @@ type System interface {
 //
 // The return value is the last tick on which events occurred in the
 // simulation. This may or may not be equal to maxTicks.
-func RunSimulation(sys System, maxTicks int) (finalTick int) {
-	var sch *Schedule
-	var p *Processor
-	var clock int
+//
+// Run may be called again with a larger maxTicks, in which case the
+// simulation picks up where it left off.
+//
+// If the Schedule runs out of events before maxTicks, which can happen in a
+// closed network once its whole population has been lost, Run returns the
+// current clock.
+func (sim *Simulation) Run(maxTicks int) (finalTick int) {
+	var sys System
 	var ev simEvent
-	var events []simEvent
+	var ok bool
+
+	sys = sim.Sys
+	if !sim.started {
+		sim.start()
+	}
+	for sim.clock <= maxTicks {
+		if sim.sch.Len() == 0 {
+			D("Schedule is empty; stopping at tick", sim.clock)
+			break
+		}
+		sim.clock = sim.sch.events[0].ev.T
+		D()
+		D("BEGIN TICK", sim.clock)
+		sys.BeforeEvents(sim.clock)
+		// Events are taken off the Schedule one at a time, so that an event
+		// can still cancel another one that shares its tick.
+		for ev, ok = sim.sch.pop(sim.clock); ok; ev, ok = sim.sch.pop(sim.clock) {
+			ev.F(sim.clock)
+		}
+		sys.AfterEvents(sim.clock)
+		D("END TICK", sim.clock)
+	}
+
+	return sim.clock
+}
+
+// RunUntil runs the simulation step ticks at a time until the confidence
+// interval returned by estimate satisfies rule, or until maxTicks is
+// reached.
+//
+// This is meant for estimating steady-state quantities from a single long
+// run. estimate will usually compute a batch-means interval from the
+// observations collected so far; see analysis.BatchMeansCI.
+func (sim *Simulation) RunUntil(step, maxTicks int, estimate func() analysis.Interval, rule analysis.StoppingRule) (finalTick int, iv analysis.Interval, ok bool) {
+	var target int
+	for target = step; ; target += step {
+		if target > maxTicks {
+			target = maxTicks
+		}
+		finalTick = sim.Run(target)
+		iv = estimate()
+		if rule.Satisfied(iv) {
+			return finalTick, iv, true
+		}
+		if finalTick >= maxTicks || rule.Exhausted(iv) {
+			return finalTick, iv, false
+		}
+	}
+}
 
+// start initializes the System and schedules the first events.
+func (sim *Simulation) start() {
+	var sys System
+	var p *Processor
+
+	sim.started = true
+	sys = sim.Sys
+	if sa, ok := sys.(SimulationAware); ok {
+		sa.SetSimulation(sim)
+	}
 	sys.Init()
-	sch = NewSchedule()
 
-	// Schedule Processor-finish events. Each Processor gets an AfterStart
-	// callback that schedules a Finish() call for that processor to occur
-	// when the processing time has elapsed.
+	// Let the built-in components know which Simulation they belong to.
+	sim.bind(sys.ArrProc())
+	sim.bind(sys.ArrBeh())
+	for _, p = range sys.Processors() {
+		sim.bind(p)
+		sim.bind(p.Discipline())
+	}
+
+	// Schedule Job-finish events. Each Processor gets an AfterStart
+	// callback that schedules a FinishJob() call for the Job that was just
+	// started, to occur when the processing time has elapsed. A Processor
+	// with a Capacity greater than 1 may have several of these pending at
+	// once.
+	//
+	// We hold on to the handle of each Job's pending finish event. If the
+	// Job gets finished some other way (say, a callback decided to pull it
+	// out mid-service), or is preempted or evicted, or its Processor fails,
+	// the pending event is canceled.
 	cbAfterStart := func(cbProcessor *Processor, cbJob *Job, cbProcTime int) {
+		// Start was called on a busy Processor, so nothing was started.
+		if cbJob == nil || cbProcTime == 0 {
+			return
+		}
 		eventCb := func(cbClock int) {
-			cbProcessor.Finish()
+			delete(sim.finishEvents, cbJob)
+			cbProcessor.FinishJob(cbJob)
+		}
+		sim.finishEvents[cbJob] = sim.ScheduleAfter(cbProcTime, eventCb)
+	}
+	cbBeforeFinish := func(cbProcessor *Processor, cbJob *Job) {
+		if h, ok := sim.finishEvents[cbJob]; ok {
+			h.Cancel()
+			delete(sim.finishEvents, cbJob)
+		}
+	}
+	cbBeforePreempt := func(cbProcessor *Processor, cbNewJob, cbEvicted *Job) {
+		cbBeforeFinish(cbProcessor, cbEvicted)
+	}
+	cbBeforeFail := func(cbProcessor *Processor) {
+		for _, j := range cbProcessor.Jobs {
+			cbBeforeFinish(cbProcessor, j)
 		}
-		sch.Add(simEvent{clock + cbProcTime, eventCb})
 	}
 	for _, p = range sys.Processors() {
 		p.AfterStart(cbAfterStart)
+		p.BeforeFinish(cbBeforeFinish)
+		p.BeforePreempt(cbBeforePreempt)
+		p.BeforeFail(cbBeforeFail)
+		p.evictHooks = append(p.evictHooks, cbBeforeFinish)
 	}
 
 	// Schedule arrival events, including the initial one.
 	cbAfterArrive := func(cbArrProc ArrProc, cbJobs []*Job, cbInterval int) {
+		if cbInterval < 0 {
+			return
+		}
 		eventCb := func(cbClock int) {
 			sys.ArrProc().Arrive(cbClock)
 		}
-		sch.Add(simEvent{clock + cbInterval, eventCb})
+		sim.ScheduleAfter(cbInterval, eventCb)
 	}
 	sys.ArrProc().AfterArrive(cbAfterArrive)
-	sch.Add(simEvent{0, func(cbClock int) { sys.ArrProc().Arrive(cbClock) }})
+	sim.ScheduleAt(0, func(cbClock int) { sys.ArrProc().Arrive(cbClock) })
 
-	// Run the simulation.
 	sys.BeforeFirstTick()
-	for clock = 0; clock <= maxTicks; {
-		events, clock = sch.NextTick()
-		D()
-		D("BEGIN TICK", clock)
-		sys.BeforeEvents(clock)
-		for _, ev = range events {
-			ev.F(clock)
-		}
-		sys.AfterEvents(clock)
-		D("END TICK", clock)
+
+	// If any Jobs were queued before the clock started, idle Processors
+	// should get to work on them right away.
+	pullIdle(sys.Processors())
+}
+
+// A simBinder is a built-in component that wants to know which Simulation
+// it's part of. Simulation.Run binds the System's ArrProc, ArrBeh,
+// Processors, and the Processors' Disciplines right after Init.
+type simBinder interface {
+	bindSimulation(sim *Simulation)
+}
+
+// bind lets x know that it's part of the Simulation, if x is a built-in
+// component that cares.
+func (sim *Simulation) bind(x interface{}) {
+	if b, ok := x.(simBinder); ok {
+		b.bindSimulation(sim)
+	}
+}
+
+// NewSimulation creates a Simulation of the given System. Call Run to start
+// it.
+func NewSimulation(sys System, opts ...Option) *Simulation {
+	var sim *Simulation
+	var opt Option
+
+	sim = &Simulation{
+		Sys:          sys,
+		sch:          NewSchedule(),
+		finishEvents: make(map[*Job]*EventHandle),
+	}
+	for _, opt = range opts {
+		opt(sim)
+	}
+	if sim.Rand == nil {
+		sim.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
 	}
+	return sim
+}
 
-	return clock
+// RunSimulation simulates a queueing system for a certain number of ticks.
+//
+// It's shorthand for NewSimulation(sys, opts...).Run(maxTicks); see
+// Simulation.Run for details. To make the run reproducible, pass
+// WithSeed(seed).
+func RunSimulation(sys System, maxTicks int, opts ...Option) (finalTick int) {
+	return NewSimulation(sys, opts...).Run(maxTicks)
 }
@@ -1,7 +1,11 @@
 package qsim
 
 import (
+	"math/rand"
+	"sort"
 	"testing"
+
+	"github.com/danslimmon/qsim/analysis"
 )
 
 func TestSchedule(t *testing.T) {
@@ -43,3 +47,447 @@ func TestSchedule(t *testing.T) {
 		}
 	}
 }
+
+// Tests that events scheduled for the same tick come out in the order in
+// which they were added.
+func TestScheduleFIFO(t *testing.T) {
+	t.Parallel()
+	var sch *Schedule
+	var events []simEvent
+	var order []int
+	var i int
+
+	sch = NewSchedule()
+	for i = 0; i < 50; i++ {
+		i := i
+		sch.Add(simEvent{7 - i%2, func(clock int) { order = append(order, i) }})
+	}
+
+	for sch.Len() > 0 {
+		events, _ = sch.NextTick()
+		for _, ev := range events {
+			ev.F(0)
+		}
+	}
+	for i = 1; i < len(order); i++ {
+		if order[i]%2 == order[i-1]%2 && order[i] < order[i-1] {
+			t.Log("Events at the same tick ran out of order:", order)
+			t.Fail()
+			break
+		}
+	}
+	if order[0] != 1 || order[25] != 0 {
+		t.Log("Events ran out of time order:", order)
+		t.Fail()
+	}
+}
+
+// Tests canceling events through their EventHandles.
+func TestEventHandleCancel(t *testing.T) {
+	t.Parallel()
+	var sch *Schedule
+	var h2, h5 *EventHandle
+	var events []simEvent
+	var tick int
+	f := func(clock int) {}
+
+	sch = NewSchedule()
+	h2 = sch.Add(simEvent{2, f})
+	h5 = sch.Add(simEvent{5, f})
+	sch.Add(simEvent{5, f})
+
+	if !h2.Cancel() {
+		t.Log("Cancel on a pending event should return true")
+		t.Fail()
+	}
+	if h2.Cancel() {
+		t.Log("Cancel on an already-canceled event should return false")
+		t.Fail()
+	}
+	if h2.Pending() {
+		t.Log("Canceled event still reports itself as pending")
+		t.Fail()
+	}
+	h5.Cancel()
+
+	events, tick = sch.NextTick()
+	if tick != 5 || len(events) != 1 {
+		t.Log("Expected 1 event at tick 5 but got", len(events), "at tick", tick)
+		t.Fail()
+	}
+	if sch.Len() != 0 {
+		t.Log("Expected empty Schedule but it has", sch.Len(), "events")
+		t.Fail()
+	}
+}
+
+// Tests moving events around with EventHandle.Reschedule.
+func TestEventHandleReschedule(t *testing.T) {
+	t.Parallel()
+	var sch *Schedule
+	var h *EventHandle
+	var events []simEvent
+	var tick int
+	var ran []string
+
+	sch = NewSchedule()
+	h = sch.Add(simEvent{3, func(clock int) { ran = append(ran, "moved") }})
+	sch.Add(simEvent{8, func(clock int) { ran = append(ran, "fixed") }})
+	sch.Add(simEvent{4, func(clock int) {}})
+
+	h.Reschedule(8)
+	if h.Time() != 8 {
+		t.Log("Expected rescheduled event to have time 8 but got", h.Time())
+		t.Fail()
+	}
+	events, tick = sch.NextTick()
+	if tick != 4 {
+		t.Log("Expected first tick to be 4 but got", tick)
+		t.Fail()
+	}
+	events, tick = sch.NextTick()
+	for _, ev := range events {
+		ev.F(tick)
+	}
+	if tick != 8 || len(ran) != 2 || ran[0] != "fixed" || ran[1] != "moved" {
+		t.Log("Expected rescheduled event to run at tick 8 after the existing event; got", ran, "at tick", tick)
+		t.Fail()
+	}
+
+	// An event that has already occurred can be put back in the Schedule.
+	h.Reschedule(10)
+	if !h.Pending() || sch.Len() != 1 {
+		t.Log("Rescheduling an event that already occurred should put it back in the Schedule")
+		t.Fail()
+	}
+}
+
+// interruptSystem is a minimal System for testing RunSimulation. Jobs arrive
+// every Interval ticks and are processed by a single Processor taking
+// ProcTime ticks apiece; jobs that arrive while the Processor is busy are
+// dropped. At tick InterruptAt, the Job in service is pulled out of the
+// Processor and replaced with a new Job.
+type interruptSystem struct {
+	Interval, ProcTime, InterruptAt int
+
+	// The tick at which each Job finished, by JobId.
+	Finishes map[int64]int
+	// The Job started at InterruptAt.
+	Interrupter *Job
+
+	arrProc  ArrProc
+	proc     *Processor
+	arrivals []*Job
+	clock    int
+}
+
+func (sys *interruptSystem) Init() {
+	sys.Finishes = make(map[int64]int)
+	sys.arrProc = NewConstantArrProc(sys.Interval)
+	sys.arrProc.AfterArrive(func(ap ArrProc, jobs []*Job, interval int) {
+		sys.arrivals = append(sys.arrivals, jobs...)
+	})
+	sys.proc = NewProcessor(func(j *Job) int { return sys.ProcTime })
+	sys.proc.AfterFinish(func(p *Processor, j *Job) {
+		if j != nil {
+			sys.Finishes[j.JobId] = sys.clock
+		}
+	})
+}
+func (sys *interruptSystem) ArrProc() ArrProc         { return sys.arrProc }
+func (sys *interruptSystem) ArrBeh() ArrBeh           { return nil }
+func (sys *interruptSystem) Processors() []*Processor { return []*Processor{sys.proc} }
+func (sys *interruptSystem) BeforeFirstTick()         {}
+func (sys *interruptSystem) BeforeEvents(clock int) {
+	sys.clock = clock
+	if clock == sys.InterruptAt && !sys.proc.IsIdle() {
+		sys.proc.Finish()
+		sys.Interrupter = NewJob(clock)
+		sys.proc.Start(sys.Interrupter)
+	}
+}
+func (sys *interruptSystem) AfterEvents(clock int) {
+	for _, j := range sys.arrivals {
+		if sys.proc.IsIdle() {
+			sys.proc.Start(j)
+		}
+	}
+	sys.arrivals = sys.arrivals[:0]
+}
+
+// Tests that a Job pulled out of a Processor mid-service doesn't leave
+// behind a finish event that cuts short the next Job.
+func TestRunSimulationCancelsStaleFinish(t *testing.T) {
+	t.Parallel()
+	var sys *interruptSystem
+
+	sys = &interruptSystem{Interval: 10, ProcTime: 50, InterruptAt: 20}
+	RunSimulation(sys, 200)
+
+	if sys.Interrupter == nil {
+		t.Fatal("Job in service was never interrupted")
+	}
+	if sys.Finishes[sys.Interrupter.JobId] != 70 {
+		t.Log("Expected interrupting Job to finish at tick 70 but it finished at", sys.Finishes[sys.Interrupter.JobId])
+		t.Fail()
+	}
+}
+
+// timerSystem is a System that schedules its own events. Arrivals happen
+// every 100 ticks and are never processed.
+type timerSystem struct {
+	// The ticks at which our own events ran.
+	Fired []int
+	// The ticks at which BeforeEvents was called.
+	EventTicks []int
+
+	sim     *Simulation
+	arrProc ArrProc
+}
+
+func (sys *timerSystem) SetSimulation(sim *Simulation) { sys.sim = sim }
+func (sys *timerSystem) Init() {
+	sys.arrProc = NewConstantArrProc(100)
+	sys.sim.ScheduleAt(15, func(clock int) {
+		sys.Fired = append(sys.Fired, clock)
+		sys.sim.ScheduleAfter(30, func(clock int) {
+			sys.Fired = append(sys.Fired, clock)
+		})
+	})
+	sys.sim.ScheduleAt(250, func(clock int) {
+		sys.Fired = append(sys.Fired, clock)
+	}).Cancel()
+}
+func (sys *timerSystem) ArrProc() ArrProc         { return sys.arrProc }
+func (sys *timerSystem) ArrBeh() ArrBeh           { return nil }
+func (sys *timerSystem) Processors() []*Processor { return nil }
+func (sys *timerSystem) BeforeFirstTick()         {}
+func (sys *timerSystem) BeforeEvents(clock int) {
+	sys.EventTicks = append(sys.EventTicks, clock)
+}
+func (sys *timerSystem) AfterEvents(clock int) {}
+
+// funcSystem is a System for tests that need a small System of their own.
+// InitFunc sets up its components.
+type funcSystem struct {
+	InitFunc func(sys *funcSystem)
+
+	Sim   *Simulation
+	AP    ArrProc
+	AB    ArrBeh
+	Procs []*Processor
+}
+
+func (sys *funcSystem) SetSimulation(sim *Simulation) { sys.Sim = sim }
+func (sys *funcSystem) Init()                         { sys.InitFunc(sys) }
+func (sys *funcSystem) ArrProc() ArrProc              { return sys.AP }
+func (sys *funcSystem) ArrBeh() ArrBeh                { return sys.AB }
+func (sys *funcSystem) Processors() []*Processor      { return sys.Procs }
+func (sys *funcSystem) BeforeFirstTick()              {}
+func (sys *funcSystem) BeforeEvents(clock int)        {}
+func (sys *funcSystem) AfterEvents(clock int)         {}
+
+// Tests scheduling user events with ScheduleAt and ScheduleAfter.
+func TestSimulationScheduleAt(t *testing.T) {
+	t.Parallel()
+	var sys *timerSystem
+
+	sys = &timerSystem{}
+	RunSimulation(sys, 299)
+
+	if len(sys.Fired) != 2 || sys.Fired[0] != 15 || sys.Fired[1] != 45 {
+		t.Log("Expected events to fire at ticks 15 and 45 but they fired at", sys.Fired)
+		t.Fail()
+	}
+	expTicks := []int{0, 15, 45, 100, 200, 300}
+	if len(sys.EventTicks) != len(expTicks) {
+		t.Fatal("Expected BeforeEvents at ticks", expTicks, "but got", sys.EventTicks)
+	}
+	for i := range expTicks {
+		if sys.EventTicks[i] != expTicks[i] {
+			t.Log("Expected BeforeEvents at ticks", expTicks, "but got", sys.EventTicks)
+			t.Fail()
+			break
+		}
+	}
+}
+
+// Tests that scheduling an event in the past panics.
+func TestSimulationScheduleAtPast(t *testing.T) {
+	t.Parallel()
+	var sim *Simulation
+
+	sim = NewSimulation(&timerSystem{})
+	sim.clock = 10
+	defer func() {
+		if recover() == nil {
+			t.Log("Expected ScheduleAt to panic when given a past tick")
+			t.Fail()
+		}
+	}()
+	sim.ScheduleAt(9, func(clock int) {})
+}
+
+// Tests that two simulations run with the same seed come out identical,
+// and that different seeds give different results.
+func TestSimulationSeed(t *testing.T) {
+	t.Parallel()
+	var sys0, sys1, sys2 *GrocerySystem
+	var ticks int
+
+	ticks = 86400 * 1000
+	sys0 = &GrocerySystem{}
+	RunSimulation(sys0, ticks, WithSeed(42))
+	sys1 = &GrocerySystem{}
+	RunSimulation(sys1, ticks, WithSeed(42))
+	sys2 = &GrocerySystem{}
+	RunSimulation(sys2, ticks, WithSeed(43))
+
+	sojourns0, sojourns1, sojourns2 := sys0.Stats.Sojourns(), sys1.Stats.Sojourns(), sys2.Stats.Sojourns()
+	if sys0.Stats.AvgOccupancy() != sys1.Stats.AvgOccupancy() || sojourns0.Sum() != sojourns1.Sum() || sys0.Stats.Completed() != sys1.Stats.Completed() {
+		t.Log("Simulations with the same seed gave different results")
+		t.Fail()
+	}
+	if sojourns0.Sum() == sojourns2.Sum() {
+		t.Log("Simulations with different seeds gave the same results")
+		t.Fail()
+	}
+}
+
+// Tests that calling Run again continues the simulation where it left off.
+func TestSimulationResume(t *testing.T) {
+	t.Parallel()
+	var sys *timerSystem
+	var sim *Simulation
+	var finalTick int
+
+	sys = &timerSystem{}
+	sim = NewSimulation(sys)
+	finalTick = sim.Run(120)
+	if finalTick != 200 || len(sys.EventTicks) != 5 {
+		t.Log("Expected first Run to stop at tick 200 after 5 ticks; got", finalTick, sys.EventTicks)
+		t.Fail()
+	}
+	finalTick = sim.Run(299)
+	if finalTick != 300 || len(sys.EventTicks) != 6 {
+		t.Log("Expected second Run to stop at tick 300 after 6 ticks; got", finalTick, sys.EventTicks)
+		t.Fail()
+	}
+}
+
+// Tests estimating a steady-state mean from a single run with RunUntil.
+func TestSimulationRunUntil(t *testing.T) {
+	t.Parallel()
+	var sys *GrocerySystem
+	var sim *Simulation
+	var obs []float64
+	var rule analysis.StoppingRule
+	var iv analysis.Interval
+	var ok bool
+	var finalTick int
+
+	sys = &GrocerySystem{}
+	sim = NewSimulation(sys, WithSeed(5))
+	// Each observation is the average number of customers in the store
+	// over one step of the simulation.
+	var prevArea float64
+	var prevClock int
+	estimate := func() analysis.Interval {
+		area := sys.Stats.AvgOccupancy() * float64(sim.Clock())
+		obs = append(obs, (area-prevArea)/float64(sim.Clock()-prevClock))
+		prevArea, prevClock = area, sim.Clock()
+		return analysis.BatchMeansCI(obs, 10, 0.95)
+	}
+	rule = analysis.StoppingRule{HalfWidth: 0.05, Relative: true, Confidence: 0.95, MinN: 10}
+	finalTick, iv, ok = sim.RunUntil(3600*1000, 30*86400*1000, estimate, rule)
+	if !ok {
+		t.Fatal("Expected to reach 5% precision within 30 days; got", iv)
+	}
+	if finalTick < 10*3600*1000 || iv.RelHalfWidth() >= 0.05 {
+		t.Log("RunUntil stopped at tick", finalTick, "with interval", iv)
+		t.Fail()
+	}
+}
+
+// linearSchedule is the sorted-slice Schedule implementation that the
+// heap-backed Schedule replaced. We keep it around for comparison in
+// benchmarks.
+type linearSchedule struct {
+	events []simEvent
+}
+
+func (sch *linearSchedule) Add(newEv simEvent) {
+	var i int
+	for i = len(sch.events) - 1; i >= 0; i-- {
+		if sch.events[i].T <= newEv.T {
+			break
+		}
+	}
+	sch.events = append(sch.events, simEvent{})
+	copy(sch.events[i+2:], sch.events[i+1:])
+	sch.events[i+1] = newEv
+}
+
+func (sch *linearSchedule) NextTick() (events []simEvent, tick int) {
+	var i int
+	events = append(events, sch.events[0])
+	for i = 1; i < len(sch.events) && sch.events[i].T == events[0].T; i++ {
+		events = append(events, sch.events[i])
+	}
+	sch.events = sch.events[i:]
+	return events, events[0].T
+}
+
+// benchSchedule measures the cost of one "hold" operation (schedule a new
+// event at a random future time, then advance to the next tick) on a
+// schedule holding roughly nPending events.
+func benchSchedule(b *testing.B, nPending int, add func(simEvent), next func() ([]simEvent, int)) {
+	var clock int
+	f := func(clock int) {}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < nPending; i++ {
+		add(simEvent{r.Intn(nPending * 100), f})
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		add(simEvent{clock + r.Intn(nPending*100), f})
+		_, clock = next()
+	}
+}
+
+func benchHeapSchedule(b *testing.B, nPending int) {
+	sch := NewSchedule()
+	add := func(ev simEvent) {
+		sch.Add(ev)
+	}
+	benchSchedule(b, nPending, add, sch.NextTick)
+}
+
+func benchLinearSchedule(b *testing.B, nPending int) {
+	sch := new(linearSchedule)
+	// Filling the linear schedule one Add at a time would take far longer
+	// than the benchmark itself, so we sort the initial events up front.
+	fill := func(ev simEvent) {
+		sch.events = append(sch.events, ev)
+	}
+	first := true
+	add := func(ev simEvent) {
+		if first && len(sch.events) == nPending {
+			sort.Slice(sch.events, func(i, j int) bool { return sch.events[i].T < sch.events[j].T })
+			first = false
+		}
+		if first {
+			fill(ev)
+		} else {
+			sch.Add(ev)
+		}
+	}
+	benchSchedule(b, nPending, add, sch.NextTick)
+}
+
+func BenchmarkSchedule10k(b *testing.B)        { benchHeapSchedule(b, 10000) }
+func BenchmarkSchedule100k(b *testing.B)       { benchHeapSchedule(b, 100000) }
+func BenchmarkSchedule1M(b *testing.B)         { benchHeapSchedule(b, 1000000) }
+func BenchmarkLinearSchedule10k(b *testing.B)  { benchLinearSchedule(b, 10000) }
+func BenchmarkLinearSchedule100k(b *testing.B) { benchLinearSchedule(b, 100000) }
+func BenchmarkLinearSchedule1M(b *testing.B)   { benchLinearSchedule(b, 1000000) }
@@ -0,0 +1,502 @@
+package qsim
+
+import (
+	"sort"
+
+	"github.com/danslimmon/qsim/analysis"
+)
+
+// QueueStats collects statistics about a Queue by hooking into its
+// callbacks. Create one with NewQueueStats.
+//
+// Nothing that happens before the WarmUp tick is counted, so that the
+// initial transient behavior of the system doesn't skew the results.
+type QueueStats struct {
+	// The Queue being observed.
+	Queue *Queue
+	// WarmUp is the tick at which collection begins.
+	WarmUp int
+	// Appended is the number of Jobs that were appended to the Queue.
+	Appended int
+	// Dropped is the number of Jobs that were discarded by Append because
+	// the Queue was already at its MaxLength.
+	Dropped int
+	// AppendedByClass and DroppedByClass break Appended and Dropped down by
+	// Job Class.
+	AppendedByClass map[string]int
+	DroppedByClass  map[string]int
+	// MaxLength is the greatest length the Queue reached.
+	MaxLength int
+
+	sim *Simulation
+	// The length of the Queue as of the last time we looked at it, and the
+	// tick at which we looked.
+	length     int
+	lastChange int
+	// The integral of the Queue's length over time since WarmUp.
+	area int
+}
+
+// observe brings the time-weighted length up to date and notes the Queue's
+// new length.
+func (qs *QueueStats) observe() {
+	var now int
+	now = qs.sim.clock
+	if now >= qs.WarmUp {
+		qs.area += qs.length * (now - maxInt(qs.lastChange, qs.WarmUp))
+		qs.MaxLength = maxInt(qs.MaxLength, maxInt(qs.length, qs.Queue.Length()))
+	}
+	qs.length = qs.Queue.Length()
+	qs.lastChange = now
+}
+
+// AvgLength returns the time-weighted average length of the Queue between
+// WarmUp and the current clock time.
+func (qs *QueueStats) AvgLength() float64 {
+	var now, area int
+	now = qs.sim.clock
+	if now <= qs.WarmUp {
+		return 0
+	}
+	area = qs.area + qs.length*(now-maxInt(qs.lastChange, qs.WarmUp))
+	return float64(area) / float64(now-qs.WarmUp)
+}
+
+// NewQueueStats starts collecting statistics about q in sim, ignoring
+// everything that happens before warmUp.
+func NewQueueStats(sim *Simulation, q *Queue, warmUp int) *QueueStats {
+	var qs *QueueStats
+
+	qs = &QueueStats{Queue: q, WarmUp: warmUp, sim: sim}
+	qs.AppendedByClass = make(map[string]int)
+	qs.DroppedByClass = make(map[string]int)
+	qs.length = q.Length()
+	qs.lastChange = sim.clock
+
+	// The AfterAppend callbacks aren't told which Job was dropped, so we
+	// note it beforehand.
+	var appending *Job
+	q.BeforeAppend(func(cbQueue *Queue, cbJob *Job) {
+		appending = cbJob
+	})
+	q.AfterAppend(func(cbQueue *Queue, cbJob *Job) {
+		if sim.clock >= qs.WarmUp && appending != nil {
+			if cbJob == nil {
+				qs.Dropped++
+				qs.DroppedByClass[appending.Class]++
+			} else {
+				qs.Appended++
+				qs.AppendedByClass[cbJob.Class]++
+			}
+		}
+		qs.observe()
+	})
+	q.AfterShift(func(cbQueue *Queue, cbJob *Job) {
+		qs.observe()
+	})
+	q.AfterRemove(func(cbQueue *Queue, cbJob *Job) {
+		qs.observe()
+	})
+	return qs
+}
+
+// JobStats summarizes a set of completed Jobs.
+type JobStats struct {
+	// Completed is the number of Jobs.
+	Completed int
+	// Waits holds the time each Job spent waiting in a Queue.
+	Waits analysis.Tally
+	// Sojourns holds the time each Job spent in the system, from its
+	// arrival to its departure.
+	Sojourns analysis.Tally
+	// WaitQuantiles and SojournQuantiles hold the same observations as
+	// Waits and Sojourns, for estimating percentiles.
+	WaitQuantiles    analysis.Sketch
+	SojournQuantiles analysis.Sketch
+}
+
+// add records a completed Job.
+func (js *JobStats) add(j *Job) {
+	var w, s int
+	js.Completed++
+	if w = j.WaitTime(); w >= 0 {
+		js.Waits.Add(float64(w))
+		js.WaitQuantiles.Add(float64(w))
+	}
+	if s = j.SojournTime(); s >= 0 {
+		js.Sojourns.Add(float64(s))
+		js.SojournQuantiles.Add(float64(s))
+	}
+}
+
+// merge adds all the Jobs recorded by other to js.
+func (js *JobStats) merge(other *JobStats) {
+	js.Completed += other.Completed
+	js.Waits.Merge(&other.Waits)
+	js.Sojourns.Merge(&other.Sojourns)
+	js.WaitQuantiles.Merge(&other.WaitQuantiles)
+	js.SojournQuantiles.Merge(&other.SojournQuantiles)
+}
+
+// ProcessorStats collects statistics about a Processor and the Jobs it
+// serves by hooking into its callbacks. Create one with NewProcessorStats.
+//
+// Nothing that happens before the WarmUp tick is counted. Wait and sojourn
+// times are recorded for Jobs that finish at or after WarmUp.
+type ProcessorStats struct {
+	// The Processor being observed.
+	Processor *Processor
+	// WarmUp is the tick at which collection begins.
+	WarmUp int
+	// Statistics about all the Jobs the Processor has finished.
+	JobStats
+	// Classes breaks the Jobs down by Class.
+	Classes map[string]*JobStats
+	// Preempted is the number of Jobs the Processor has evicted with
+	// Preempt.
+	Preempted int
+	// Failures is the number of times the Processor has failed, and Lost
+	// is the number of Jobs that were lost when it did.
+	Failures int
+	Lost     int
+	// Evicted is the number of Jobs that were evicted when the Processor
+	// was closed or resized with CloseHard.
+	Evicted int
+	// Setups holds the duration of each setup the Processor has done (see
+	// Processor.Setup). Jobs that needed no setup aren't counted. Setup
+	// time is counted in BusyTime, since the Processor isn't free to start
+	// anything else, but Setups.Sum() tells you how much of it there was.
+	Setups analysis.Tally
+
+	sim *Simulation
+	// The number of Jobs in service as of the last time we looked at the
+	// Processor, and the tick at which we looked.
+	busy       int
+	lastChange int
+	// The number of ticks the Processor has spent busy since WarmUp,
+	// counting each Job in service separately.
+	busyTime int
+	// The number of slots the Processor had as of the last time we looked
+	// at it, and the number of ticks its slots have been staffed since
+	// WarmUp, counting each slot separately.
+	slots     int
+	staffTime int
+	// The number of ticks the Processor has spent down since WarmUp, not
+	// counting the current failure, and when that failure began.
+	downTime  int
+	downSince int
+}
+
+// observe brings the busy time up to date and notes how many Jobs are in
+// service now.
+func (ps *ProcessorStats) observe() {
+	var now int
+	now = ps.sim.clock
+	if now >= ps.WarmUp {
+		ps.busyTime += ps.busy * (now - maxInt(ps.lastChange, ps.WarmUp))
+		ps.staffTime += ps.slots * (now - maxInt(ps.lastChange, ps.WarmUp))
+	}
+	ps.busy = ps.Processor.InService()
+	ps.slots = ps.capacity()
+	ps.lastChange = now
+}
+
+// BusyTime returns the number of ticks the Processor has spent working on
+// Jobs between WarmUp and the current clock time. If the Processor's
+// Capacity is greater than 1, each of its slots is counted separately: two
+// Jobs in service for 10 ticks make 20 ticks of busy time.
+func (ps *ProcessorStats) BusyTime() int {
+	var now int
+	now = ps.sim.clock
+	if now <= ps.WarmUp {
+		return 0
+	}
+	return ps.busyTime + ps.busy*(now-maxInt(ps.lastChange, ps.WarmUp))
+}
+
+// StaffedTime returns the number of ticks the Processor's slots have been
+// available for work between WarmUp and the current clock time, counting
+// each slot separately. It only differs from the elapsed time multiplied
+// by the Capacity if the Processor has been closed or resized.
+func (ps *ProcessorStats) StaffedTime() int {
+	var now int
+	now = ps.sim.clock
+	if now <= ps.WarmUp {
+		return 0
+	}
+	return ps.staffTime + ps.slots*(now-maxInt(ps.lastChange, ps.WarmUp))
+}
+
+// IdleTime returns the number of ticks the Processor's slots have spent
+// idle between WarmUp and the current clock time. Slots don't count as
+// idle while the Processor is closed.
+func (ps *ProcessorStats) IdleTime() int {
+	return ps.StaffedTime() - ps.BusyTime()
+}
+
+// Utilization returns the fraction of the Processor's capacity that has been
+// in use since WarmUp, not counting the time it spent closed.
+func (ps *ProcessorStats) Utilization() float64 {
+	if ps.StaffedTime() == 0 {
+		return 0
+	}
+	return float64(ps.BusyTime()) / float64(ps.StaffedTime())
+}
+
+// AvgInService returns the time-weighted average number of Jobs the
+// Processor has been working on since WarmUp. For a Processor with a
+// Capacity of 1, this is the same as its Utilization.
+func (ps *ProcessorStats) AvgInService() float64 {
+	if ps.elapsed() == 0 {
+		return 0
+	}
+	return float64(ps.BusyTime()) / float64(ps.elapsed())
+}
+
+// DownTime returns the number of ticks the Processor has spent down
+// between WarmUp and the current clock time.
+func (ps *ProcessorStats) DownTime() int {
+	var now int
+	now = ps.sim.clock
+	if !ps.Processor.IsDown() || now <= ps.WarmUp {
+		return ps.downTime
+	}
+	return ps.downTime + now - maxInt(ps.downSince, ps.WarmUp)
+}
+
+// Availability returns the fraction of the time since WarmUp that the
+// Processor hasn't been down.
+func (ps *ProcessorStats) Availability() float64 {
+	if ps.elapsed() == 0 {
+		return 1
+	}
+	return 1 - float64(ps.DownTime())/float64(ps.elapsed())
+}
+
+// capacity returns the number of Jobs the Processor can work on at once.
+// A closed Processor only has slots for the Jobs it's still finishing.
+func (ps *ProcessorStats) capacity() int {
+	if ps.Processor.IsClosed() {
+		return ps.Processor.InService()
+	}
+	return maxInt(ps.Processor.InService(), maxInt(ps.Processor.Capacity, 1))
+}
+
+// Throughput returns the number of Jobs the Processor has completed per
+// tick since WarmUp.
+func (ps *ProcessorStats) Throughput() float64 {
+	if ps.elapsed() == 0 {
+		return 0
+	}
+	return float64(ps.Completed) / float64(ps.elapsed())
+}
+
+// elapsed returns the number of ticks since WarmUp.
+func (ps *ProcessorStats) elapsed() int {
+	return maxInt(ps.sim.clock-ps.WarmUp, 0)
+}
+
+// NewProcessorStats starts collecting statistics about p in sim, ignoring
+// everything that happens before warmUp.
+func NewProcessorStats(sim *Simulation, p *Processor, warmUp int) *ProcessorStats {
+	var ps *ProcessorStats
+
+	ps = &ProcessorStats{Processor: p, WarmUp: warmUp, sim: sim}
+	ps.Classes = make(map[string]*JobStats)
+	ps.busy = p.InService()
+	ps.slots = ps.capacity()
+	ps.lastChange = sim.clock
+
+	p.AfterStart(func(cbProc *Processor, cbJob *Job, cbProcTime int) {
+		ps.observe()
+	})
+	p.AfterFinish(func(cbProc *Processor, cbJob *Job) {
+		if cbJob != nil && sim.clock >= ps.WarmUp {
+			ps.JobStats.add(cbJob)
+			if ps.Classes[cbJob.Class] == nil {
+				ps.Classes[cbJob.Class] = new(JobStats)
+			}
+			ps.Classes[cbJob.Class].add(cbJob)
+		}
+		ps.observe()
+	})
+	p.AfterSetup(func(cbProc *Processor, cbJob *Job, cbSetupTime int) {
+		if cbSetupTime > 0 && sim.clock >= ps.WarmUp {
+			ps.Setups.Add(float64(cbSetupTime))
+		}
+	})
+	p.AfterPreempt(func(cbProc *Processor, cbNewJob, cbEvicted *Job) {
+		if sim.clock >= ps.WarmUp {
+			ps.Preempted++
+		}
+		ps.observe()
+	})
+	p.AfterFail(func(cbProc *Processor, cbLost []*Job) {
+		if sim.clock >= ps.WarmUp {
+			ps.Failures++
+			ps.Lost += len(cbLost)
+		}
+		ps.downSince = sim.clock
+		ps.observe()
+	})
+	p.BeforeRepair(func(cbProc *Processor) {
+		ps.downTime = ps.DownTime()
+	})
+	p.AfterRepair(func(cbProc *Processor) {
+		ps.observe()
+	})
+	p.AfterClose(func(cbProc *Processor, cbEvicted []*Job) {
+		if sim.clock >= ps.WarmUp {
+			ps.Evicted += len(cbEvicted)
+		}
+		ps.observe()
+	})
+	p.AfterOpen(func(cbProc *Processor) {
+		ps.observe()
+	})
+	p.AfterResize(func(cbProc *Processor, cbEvicted []*Job) {
+		if sim.clock >= ps.WarmUp {
+			ps.Evicted += len(cbEvicted)
+		}
+		ps.observe()
+	})
+	return ps
+}
+
+// SystemStats bundles a QueueStats for each of a System's Queues and a
+// ProcessorStats for each of its Processors, and summarizes them. Create
+// one with NewSystemStats; usually you'll do that in your System's Init.
+type SystemStats struct {
+	Queues     []*QueueStats
+	Processors []*ProcessorStats
+}
+
+// AvgQueueLength returns the time-weighted average number of Jobs waiting
+// in all the Queues put together.
+func (ss *SystemStats) AvgQueueLength() (avg float64) {
+	for _, qs := range ss.Queues {
+		avg += qs.AvgLength()
+	}
+	return avg
+}
+
+// AvgOccupancy returns the time-weighted average number of Jobs in the
+// system, whether waiting in a Queue or being processed.
+func (ss *SystemStats) AvgOccupancy() (avg float64) {
+	avg = ss.AvgQueueLength()
+	for _, ps := range ss.Processors {
+		avg += ps.AvgInService()
+	}
+	return avg
+}
+
+// Dropped returns the number of Jobs that were discarded by full Queues.
+func (ss *SystemStats) Dropped() (n int) {
+	for _, qs := range ss.Queues {
+		n += qs.Dropped
+	}
+	return n
+}
+
+// Completed returns the number of Jobs that were finished by any Processor.
+func (ss *SystemStats) Completed() (n int) {
+	for _, ps := range ss.Processors {
+		n += ps.Completed
+	}
+	return n
+}
+
+// Throughput returns the number of Jobs completed per tick by all the
+// Processors put together.
+func (ss *SystemStats) Throughput() (tp float64) {
+	for _, ps := range ss.Processors {
+		tp += ps.Throughput()
+	}
+	return tp
+}
+
+// Waits returns the wait times of all the Jobs completed by any Processor.
+func (ss *SystemStats) Waits() (t analysis.Tally) {
+	for _, ps := range ss.Processors {
+		t.Merge(&ps.Waits)
+	}
+	return t
+}
+
+// Sojourns returns the sojourn times of all the Jobs completed by any
+// Processor.
+func (ss *SystemStats) Sojourns() (t analysis.Tally) {
+	for _, ps := range ss.Processors {
+		t.Merge(&ps.Sojourns)
+	}
+	return t
+}
+
+// WaitQuantiles returns a Sketch of the wait times of all the Jobs
+// completed by any Processor.
+func (ss *SystemStats) WaitQuantiles() (s analysis.Sketch) {
+	for _, ps := range ss.Processors {
+		s.Merge(&ps.WaitQuantiles)
+	}
+	return s
+}
+
+// SojournQuantiles returns a Sketch of the sojourn times of all the Jobs
+// completed by any Processor.
+func (ss *SystemStats) SojournQuantiles() (s analysis.Sketch) {
+	for _, ps := range ss.Processors {
+		s.Merge(&ps.SojournQuantiles)
+	}
+	return s
+}
+
+// Class returns statistics about the Jobs of the given Class completed by
+// any Processor.
+func (ss *SystemStats) Class(class string) (js JobStats) {
+	for _, ps := range ss.Processors {
+		if cs, ok := ps.Classes[class]; ok {
+			js.merge(cs)
+		}
+	}
+	return js
+}
+
+// Classes returns the Classes of all the Jobs completed by any Processor,
+// in alphabetical order.
+func (ss *SystemStats) Classes() (classes []string) {
+	seen := make(map[string]bool)
+	for _, ps := range ss.Processors {
+		for class := range ps.Classes {
+			if !seen[class] {
+				seen[class] = true
+				classes = append(classes, class)
+			}
+		}
+	}
+	sort.Strings(classes)
+	return classes
+}
+
+// NewSystemStats starts collecting statistics about the given Queues and
+// Processors in sim, ignoring everything that happens before warmUp.
+func NewSystemStats(sim *Simulation, queues []*Queue, procs []*Processor, warmUp int) *SystemStats {
+	var ss *SystemStats
+	var q *Queue
+	var p *Processor
+
+	ss = new(SystemStats)
+	for _, q = range queues {
+		ss.Queues = append(ss.Queues, NewQueueStats(sim, q, warmUp))
+	}
+	for _, p = range procs {
+		ss.Processors = append(ss.Processors, NewProcessorStats(sim, p, warmUp))
+	}
+	return ss
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,192 @@
+package qsim
+
+import (
+	"math"
+	"testing"
+)
+
+// Tests the statistics collected by QueueStats and ProcessorStats, including
+// the warm-up cutoff.
+func TestQueueAndProcessorStats(t *testing.T) {
+	t.Parallel()
+	var sim *Simulation
+	var q *Queue
+	var p *Processor
+	var qs *QueueStats
+	var ps *ProcessorStats
+	var j0 *Job
+
+	sim = NewSimulation(&GrocerySystem{}, WithSeed(1))
+	q = NewQueue()
+	q.MaxLength = 2
+	p = NewProcessor(simplePtg)
+	p.bindSimulation(sim)
+	qs = NewQueueStats(sim, q, 100)
+	ps = NewProcessorStats(sim, p, 100)
+
+	// Before the warm-up cutoff: fill the Queue and drop a Job.
+	j0 = sim.NewJob()
+	q.Append(j0)
+	q.Append(sim.NewJob())
+	q.Append(sim.NewJob())
+	sim.clock = 50
+	q.Shift()
+	p.Start(j0)
+
+	// After the warm-up cutoff: fill the Queue again and drop a Job.
+	sim.clock = 150
+	q.Append(sim.NewJob())
+	q.Append(sim.NewJob())
+	sim.clock = 343
+	p.Finish()
+	sim.clock = 400
+
+	if qs.Appended != 1 || qs.Dropped != 1 {
+		t.Log("Expected 1 append and 1 drop after warm-up but got", qs.Appended, "and", qs.Dropped)
+		t.Fail()
+	}
+	if qs.MaxLength != 2 {
+		t.Log("Expected MaxLength 2 but got", qs.MaxLength)
+		t.Fail()
+	}
+	// Length 1 from 100 to 150, then length 2 from 150 to 400.
+	if math.Abs(qs.AvgLength()-550.0/300.0) > 1e-9 {
+		t.Log("Expected AvgLength", 550.0/300.0, "but got", qs.AvgLength())
+		t.Fail()
+	}
+
+	if ps.BusyTime() != 243 || ps.IdleTime() != 57 {
+		t.Log("Expected 243 busy ticks and 57 idle ticks but got", ps.BusyTime(), "and", ps.IdleTime())
+		t.Fail()
+	}
+	if math.Abs(ps.Utilization()-0.81) > 1e-9 {
+		t.Log("Expected utilization 0.81 but got", ps.Utilization())
+		t.Fail()
+	}
+	if ps.Completed != 1 || math.Abs(ps.Throughput()-1.0/300.0) > 1e-9 {
+		t.Log("Expected 1 Job completed in 300 ticks but got", ps.Completed, "and throughput", ps.Throughput())
+		t.Fail()
+	}
+	if ps.Waits.Count() != 1 || ps.Waits.Mean() != 50 {
+		t.Log("Expected a single wait of 50 ticks but got", ps.Waits.Count(), "with mean", ps.Waits.Mean())
+		t.Fail()
+	}
+	if ps.Sojourns.Count() != 1 || ps.Sojourns.Mean() != 343 {
+		t.Log("Expected a single sojourn of 343 ticks but got", ps.Sojourns.Count(), "with mean", ps.Sojourns.Mean())
+		t.Fail()
+	}
+	if ps.SojournQuantiles.Count() != 1 || math.Abs(ps.SojournQuantiles.Quantile(0.5)-343) > 343*ps.SojournQuantiles.RelativeError() {
+		t.Log("Expected a median sojourn of about 343 ticks but got", ps.SojournQuantiles.Quantile(0.5))
+		t.Fail()
+	}
+}
+
+// Tests that a Processor that's busy across the warm-up cutoff only gets
+// credit for the time after it.
+func TestProcessorStatsWarmUp(t *testing.T) {
+	t.Parallel()
+	var sim *Simulation
+	var p *Processor
+	var ps *ProcessorStats
+
+	sim = NewSimulation(&GrocerySystem{}, WithSeed(1))
+	p = NewProcessor(simplePtg)
+	p.bindSimulation(sim)
+	ps = NewProcessorStats(sim, p, 200)
+
+	p.Start(sim.NewJob())
+	sim.clock = 100
+	if ps.BusyTime() != 0 || ps.Utilization() != 0 {
+		t.Log("Expected no busy time before warm-up but got", ps.BusyTime())
+		t.Fail()
+	}
+	sim.clock = 293
+	p.Finish()
+	if ps.BusyTime() != 93 || ps.Completed != 1 {
+		t.Log("Expected 93 busy ticks and 1 completion but got", ps.BusyTime(), "and", ps.Completed)
+		t.Fail()
+	}
+}
+
+// Tests that Jobs are broken down by Class.
+func TestSystemStatsClasses(t *testing.T) {
+	t.Parallel()
+	var sim *Simulation
+	var q *Queue
+	var procs []*Processor
+	var ss *SystemStats
+	var i int
+
+	sim = NewSimulation(&GrocerySystem{}, WithSeed(1))
+	q = NewQueue()
+	q.MaxLength = 0
+	procs = []*Processor{NewProcessor(simplePtg), NewProcessor(simplePtg)}
+	procs[0].bindSimulation(sim)
+	procs[1].bindSimulation(sim)
+	ss = NewSystemStats(sim, []*Queue{q}, procs, 0)
+
+	for i = 0; i < 5; i++ {
+		j := sim.NewJob()
+		if i%2 == 0 {
+			j.Class = "expedited"
+		} else {
+			j.Class = "standard"
+		}
+		procs[i%2].Start(j)
+		sim.clock += 10 * (i + 1)
+		procs[i%2].Finish()
+	}
+	j := sim.NewJob()
+	j.Class = "standard"
+	q.Append(j)
+
+	exp := ss.Class("expedited")
+	std := ss.Class("standard")
+	if exp.Completed != 3 || std.Completed != 2 {
+		t.Log("Expected 3 expedited and 2 standard Jobs but got", exp.Completed, "and", std.Completed)
+		t.Fail()
+	}
+	// Expedited Jobs took 10, 30, and 50 ticks; standard ones 20 and 40.
+	if exp.Sojourns.Mean() != 30 || std.Sojourns.Mean() != 30 || exp.Sojourns.Max() != 50 || std.Sojourns.Min() != 20 {
+		t.Log("Wrong sojourn times by class")
+		t.Fail()
+	}
+	if classes := ss.Classes(); len(classes) != 2 || classes[0] != "expedited" || classes[1] != "standard" {
+		t.Log("Expected classes [expedited standard] but got", classes)
+		t.Fail()
+	}
+	if ss.Queues[0].DroppedByClass["standard"] != 1 || ss.Dropped() != 1 {
+		t.Log("Expected one standard Job to be dropped")
+		t.Fail()
+	}
+}
+
+// Tests SystemStats against the sums that GrocerySystem keeps by hand.
+func TestSystemStatsGrocery(t *testing.T) {
+	t.Parallel()
+	var sys *GrocerySystem
+	var finalTick int
+	var avgOccupancy float64
+
+	sys = &GrocerySystem{}
+	finalTick = RunSimulation(sys, 86400*1000, WithSeed(1))
+
+	if sys.Stats.Completed() != sys.NumFinishedJobs {
+		t.Log("Expected", sys.NumFinishedJobs, "Jobs to be completed but got", sys.Stats.Completed())
+		t.Fail()
+	}
+	sojourns := sys.Stats.Sojourns()
+	if sojourns.Sum() != float64(sys.SumTotalTime) {
+		t.Log("Expected total sojourn time", sys.SumTotalTime, "but got", sojourns.Sum())
+		t.Fail()
+	}
+	avgOccupancy = float64(sys.SumCustomers) / float64(finalTick)
+	if math.Abs(sys.Stats.AvgOccupancy()-avgOccupancy) > 1e-9*avgOccupancy {
+		t.Log("Expected average occupancy", avgOccupancy, "but got", sys.Stats.AvgOccupancy())
+		t.Fail()
+	}
+	if math.Abs(sys.Stats.Throughput()-float64(sys.NumFinishedJobs)/float64(finalTick)) > 1e-12 {
+		t.Log("Expected throughput", float64(sys.NumFinishedJobs)/float64(finalTick), "but got", sys.Stats.Throughput())
+		t.Fail()
+	}
+}
@@ -0,0 +1,84 @@
+package qsim
+
+// Vacations sends a Processor away whenever it runs out of work: a
+// technician who goes off to do maintenance when there are no customers,
+// say. Create one with NewVacations.
+//
+// Whenever the Processor finishes a Job and finds nothing else to start, it
+// goes on a vacation of Duration ticks. While it's away, it's closed (see
+// Processor.Close), so it isn't idle and no Jobs are started on it. When it
+// comes back, it pulls from its Discipline. If it still has nothing to do,
+// it goes right back on vacation, unless Single is set, in which case it
+// waits for the next Job. Since vacations are taken with Close and Open,
+// they shouldn't be combined with Shifts on the same Processor.
+type Vacations struct {
+	// The Processor that goes on vacation.
+	Processor *Processor
+	// Duration returns the number of ticks the Processor's next vacation
+	// will last. A vacation lasts at least 1 tick, so that a Processor
+	// with nothing to do doesn't keep going away and coming back within
+	// the same tick.
+	Duration func(p *Processor) int
+	// Single, if it's true, makes the Processor take only one vacation
+	// each time it runs out of work. Otherwise it keeps taking them until
+	// it comes back to find work waiting.
+	Single bool
+	// Taken is the number of vacations the Processor has gone on.
+	Taken int
+
+	sim *Simulation
+	// Whether the Processor is away, and whether Stop has been called.
+	away    bool
+	stopped bool
+}
+
+// check sends the Processor on vacation if it has nothing to do.
+func (v *Vacations) check() {
+	var p *Processor
+	p = v.Processor
+	if v.stopped || v.away || p.InService() > 0 || p.IsClosed() || p.IsDown() {
+		return
+	}
+	v.away = true
+	v.Taken++
+	p.Close(CloseGraceful, nil)
+	D("Processor", p.ProcessorId, "went on vacation")
+	v.sim.ScheduleAfter(maxInt(v.Duration(p), 1), func(clock int) {
+		v.away = false
+		D("Processor", p.ProcessorId, "came back from vacation")
+		p.Open()
+		if !v.Single {
+			v.check()
+		}
+	})
+}
+
+// IsAway returns true if the Processor is on vacation.
+func (v *Vacations) IsAway() bool {
+	return v.away
+}
+
+// Stop keeps the Processor from going on any more vacations. If it's away,
+// it still comes back when its vacation is over.
+func (v *Vacations) Stop() {
+	v.stopped = true
+}
+
+// NewVacations makes p go on vacations in sim whenever it runs out of
+// work, with durations drawn from duration. If p has nothing to do at the
+// current tick, it goes on its first vacation right away.
+func NewVacations(sim *Simulation, p *Processor, duration func(p *Processor) int) *Vacations {
+	var v *Vacations
+
+	v = &Vacations{Processor: p, Duration: duration, sim: sim}
+	// The Processor pulls its next Job only after the AfterFinish
+	// callbacks have run, so we wait until then to see whether it found
+	// one.
+	p.AfterFinish(func(cbProc *Processor, cbJob *Job) {
+		if cbJob != nil {
+			sim.ScheduleAfter(0, func(clock int) { v.check() })
+		}
+	})
+	sim.ScheduleAfter(0, func(clock int) { v.check() })
+	return v
+}
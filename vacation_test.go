@@ -0,0 +1,97 @@
+package qsim
+
+import (
+	"testing"
+)
+
+// vacationSystem has a single 10-tick Processor, with arrivals every 100
+// ticks, that goes on vacations of Duration ticks.
+type vacationSystem struct {
+	funcSystem
+	Duration int
+	Single   bool
+
+	Vacations *Vacations
+	Stats     *ProcessorStats
+	// Whether a Job was ever started while the Processor was away.
+	StartedWhileAway bool
+}
+
+func (sys *vacationSystem) Init() {
+	q, p := newStation(10)
+	sys.Procs = []*Processor{p}
+	sys.AP = NewConstantArrProc(100)
+	sys.AB = NewSharedQueueArrBeh(q, sys.Procs, sys.AP)
+	sys.Stats = NewProcessorStats(sys.Sim, p, 0)
+	sys.Vacations = NewVacations(sys.Sim, p, func(p *Processor) int { return sys.Duration })
+	sys.Vacations.Single = sys.Single
+	p.AfterStart(func(p *Processor, j *Job, procTime int) {
+		if j != nil && sys.Vacations.IsAway() {
+			sys.StartedWhileAway = true
+		}
+	})
+}
+
+// Tests that a Processor keeps going on vacation until it comes back to find
+// work waiting.
+func TestVacations(t *testing.T) {
+	t.Parallel()
+	var sys *vacationSystem
+	var ps *ProcessorStats
+
+	sys = &vacationSystem{Duration: 35}
+	RunSimulation(sys, 10000, WithSeed(1))
+	ps = sys.Stats
+
+	if sys.StartedWhileAway {
+		t.Log("A Job was started while the Processor was on vacation")
+		t.Fail()
+	}
+	if sys.Vacations.Taken < 2*ps.Completed || ps.Waits.Mean() <= 5 {
+		t.Log("Expected at least 2 vacations per Job and Jobs to wait for the Processor to come back but got",
+			sys.Vacations.Taken, "vacations and a mean wait of", ps.Waits.Mean())
+		t.Fail()
+	}
+}
+
+// Tests that with Single set, a Processor takes one vacation each time it
+// runs out of work.
+func TestVacationsSingle(t *testing.T) {
+	t.Parallel()
+	var sys *vacationSystem
+	var ps *ProcessorStats
+
+	sys = &vacationSystem{Duration: 35, Single: true}
+	RunSimulation(sys, 10000, WithSeed(1))
+	ps = sys.Stats
+
+	if sys.StartedWhileAway {
+		t.Log("A Job was started while the Processor was on vacation")
+		t.Fail()
+	}
+	if sys.Vacations.Taken < ps.Completed || sys.Vacations.Taken > ps.Completed+2 {
+		t.Log("Expected one vacation per Job but got", sys.Vacations.Taken, "vacations for", ps.Completed, "Jobs")
+		t.Fail()
+	}
+}
+
+// Tests that a vacation that's supposed to take no time still takes a tick,
+// so the Simulation keeps moving.
+func TestVacationsZeroDuration(t *testing.T) {
+	t.Parallel()
+	var sys *vacationSystem
+	var ps *ProcessorStats
+
+	sys = &vacationSystem{Duration: 0}
+	RunSimulation(sys, 1000, WithSeed(1))
+	ps = sys.Stats
+
+	if sys.StartedWhileAway {
+		t.Log("A Job was started while the Processor was on vacation")
+		t.Fail()
+	}
+	if ps.Completed < 10 || sys.Vacations.Taken < 900 || sys.Vacations.Taken > 1000 {
+		t.Log("Expected at least 10 Jobs and about one vacation per idle tick but got", ps.Completed, "and", sys.Vacations.Taken)
+		t.Fail()
+	}
+}